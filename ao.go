@@ -0,0 +1,79 @@
+package main
+
+// Ambient occlusion darkens the corners of faces that are tucked in against other cells.
+// Each corner of a face looks at the three cells in front of the face that touch it: the two along its edges and
+// the one diagonally out from it, giving a level from 0 (boxed in) to 3 (open).
+
+const DEFAULT_AO_STRENGTH = 0.6 //how dark a fully occluded corner gets, 0 turns occlusion off
+
+// faceNormals are the cube's faces in the order they are in the vertices array
+var faceNormals = [6][3]int{{0, 0, -1}, {0, 0, 1}, {-1, 0, 0}, {1, 0, 0}, {0, -1, 0}, {0, 1, 0}}
+
+// faceAxes gets the two axes running along a face with its normal along axis, in the order corners are numbered by
+func faceAxes(axis int) (u, v int) {
+	switch axis {
+	case 0:
+		return 1, 2
+	case 1:
+		return 0, 2
+	}
+	return 0, 1
+}
+
+// occludes gets whether the cell at x,y,z shades the faces next to it, the edges of the world don't
+func (w *World) occludes(x, y, z int) bool {
+	if !w.IndexInRange(x, y, z) {
+		return false
+	}
+	cellType := w.Cells[x][y][z].Type
+	return cellType != AIR && cellType != WATER
+}
+
+// vertexAO gets the occlusion level of a corner from the cells along its two edges and the one diagonal to it
+func vertexAO(side1, side2, corner bool) int {
+	if side1 && side2 { //the corner cell can't be seen past both sides
+		return 0
+	}
+	level := 3
+	for _, occluded := range []bool{side1, side2, corner} {
+		if occluded {
+			level--
+		}
+	}
+	return level
+}
+
+// CornerAO gets the occlusion level of a corner of the face of the cell at x,y,z.
+// Corners are numbered with bit 0 set for the high side of the face's first axis and bit 1 for its second.
+func (w *World) CornerAO(x, y, z, face, corner int) int {
+	normal := faceNormals[face]
+	axis := 0
+	for i, n := range normal {
+		if n != 0 {
+			axis = i
+		}
+	}
+	u, v := faceAxes(axis)
+
+	front := [3]int{x + normal[0], y + normal[1], z + normal[2]}
+	side1, side2 := front, front
+	side1[u] += corner&1*2 - 1
+	side2[v] += corner>>1&1*2 - 1
+	diagonal := side1
+	diagonal[v] = side2[v]
+	return vertexAO(w.occludes(side1[0], side1[1], side1[2]), w.occludes(side2[0], side2[1], side2[2]),
+		w.occludes(diagonal[0], diagonal[1], diagonal[2]))
+}
+
+// CellAO packs the occlusion level of every face corner of the cell at x,y,z into 2 bits each,
+// corner c of face f is at bit (f*4+c)*2 counting on from the first word into the second
+func (w *World) CellAO(x, y, z int) [2]uint32 {
+	var packed [2]uint32
+	for face := range faceNormals {
+		for corner := 0; corner < 4; corner++ {
+			index := face*4 + corner
+			packed[index/16] |= uint32(w.CornerAO(x, y, z, face, corner)) << (index % 16 * 2)
+		}
+	}
+	return packed
+}
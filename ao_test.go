@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestVertexAO(t *testing.T) {
+	tests := []struct {
+		side1, side2, corner bool
+		want                 int
+	}{
+		{false, false, false, 3},
+		{false, false, true, 2},
+		{true, false, false, 2},
+		{false, true, true, 1},
+		{true, true, false, 0},
+		{true, true, true, 0},
+	}
+	for _, test := range tests {
+		if got := vertexAO(test.side1, test.side2, test.corner); got != test.want {
+			t.Errorf("vertexAO(%v, %v, %v) = %v, want %v", test.side1, test.side2, test.corner, got, test.want)
+		}
+	}
+}
+
+func TestCornerAO(t *testing.T) {
+	w := MakeWorld(3, 3, 3)
+	w.Cells[1][1][1] = Cell{Type: DIRT}
+	w.Cells[0][2][1] = Cell{Type: WALL}  //along the top face's low x edge
+	w.Cells[2][2][2] = Cell{Type: DIRT}  //diagonal to the top face's high x, high z corner
+	w.Cells[1][2][0] = Cell{Type: WATER} //water doesn't shade anything
+
+	const top = 5
+	wants := [4]int{2, 3, 2, 2} //corners numbered by x then z
+	for corner, want := range wants {
+		if got := w.CornerAO(1, 1, 1, top, corner); got != want {
+			t.Errorf("top face corner %v has level %v, want %v", corner, got, want)
+		}
+	}
+
+	packed := w.CellAO(1, 1, 1)
+	for corner, want := range wants {
+		index := top*4 + corner
+		if got := int(packed[index/16] >> (index % 16 * 2) & 3); got != want {
+			t.Errorf("packed top face corner %v has level %v, want %v", corner, got, want)
+		}
+	}
+	if got := w.CornerAO(0, 0, 0, 4, 0); got != 3 {
+		t.Errorf("the edge of the world shouldn't shade anything, got level %v", got)
+	}
+}
+
+// TestVerticesMatchFaces checks the cube in main.go has its faces in the order the occlusion code numbers them
+func TestVerticesMatchFaces(t *testing.T) {
+	if len(vertices) != 36*VERTEX_STRIDE {
+		t.Fatalf("expected 36 vertices, got %v floats", len(vertices))
+	}
+	for face, normal := range faceNormals {
+		for i := face * 6; i < face*6+6; i++ {
+			vertex := vertices[i*VERTEX_STRIDE : (i+1)*VERTEX_STRIDE]
+			for axis := 0; axis < 3; axis++ {
+				if int(vertex[5+axis]) != normal[axis] {
+					t.Fatalf("vertex %v has normal %v, face %v should be %v", i, vertex[5:8], face, normal)
+				}
+				if normal[axis] != 0 && vertex[axis]*float32(normal[axis]) != 0.5 {
+					t.Fatalf("vertex %v at %v isn't on face %v", i, vertex[:3], face)
+				}
+			}
+		}
+	}
+}
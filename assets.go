@@ -0,0 +1,61 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+//go:embed data/world.vs data/world.fs data/dirt.png data/default.scene
+//go:embed data/gpu_world.vs data/sim_blocks.comp data/sim_sources.comp data/sim_visible.comp data/sim_water_keys.comp data/sim_water_sort.comp
+//go:embed data/shadow.vs data/shadow.fs
+//go:embed data/materials.json data/wall.png data/panel.png
+var embeddedAssets embed.FS
+
+// AssetLoader loads shaders, textures and scenes by name, files in the override directory win over the embedded ones
+type AssetLoader struct {
+	OverrideDir string //empty means only use the embedded assets
+	sources     []fs.FS
+}
+
+func NewAssetLoader(overrideDir string) *AssetLoader {
+	loader := &AssetLoader{OverrideDir: overrideDir}
+	if overrideDir != "" {
+		loader.sources = append(loader.sources, os.DirFS(overrideDir))
+	}
+	embedded, _ := fs.Sub(embeddedAssets, "data") //can't fail since data is embedded
+	loader.sources = append(loader.sources, embedded)
+	return loader
+}
+
+// Open opens the asset called name
+func (a *AssetLoader) Open(name string) (fs.File, error) {
+	for _, source := range a.sources {
+		file, err := source.Open(name)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to open asset %v: %v", name, err)
+		}
+	}
+	return nil, fmt.Errorf("no asset called %v", name)
+}
+
+// ReadFile reads the whole asset called name
+func (a *AssetLoader) ReadFile(name string) ([]byte, error) {
+	file, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset %v: %v", name, err)
+	}
+	return data, nil
+}
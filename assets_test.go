@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssetLoaderOverride(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "world.fs"), []byte("edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := NewAssetLoader("").ReadFile("world.fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAssetLoader(dir)
+	if data, err := a.ReadFile("world.fs"); err != nil || string(data) != "edited" {
+		t.Errorf("the file in the override directory should win, got %q and %v", data, err)
+	}
+	//anything not in the directory comes from the binary
+	if data, err := a.ReadFile("world.vs"); err != nil || len(data) == 0 {
+		t.Errorf("a file missing from the override directory should fall back to the built in one, got %v", err)
+	}
+	if len(embedded) == 0 || string(embedded) == "edited" {
+		t.Errorf("without an override directory the built in file should be used")
+	}
+	if _, err := a.ReadFile("missing.fs"); err == nil || !strings.Contains(err.Error(), "no asset called missing.fs") {
+		t.Errorf("expected a missing asset error, got %v", err)
+	}
+}
+
+// TestAssetLoaderErrors checks errors other than a file not being there are reported rather than quietly falling
+// back to the built in file
+func TestAssetLoaderErrors(t *testing.T) {
+	dir := t.TempDir()
+	//a file where a directory should be can't be opened, but isn't missing either
+	if err := os.WriteFile(filepath.Join(dir, "shaders"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a := NewAssetLoader(dir)
+	for _, name := range []string{"shaders/world.fs", "../world.fs"} {
+		if _, err := a.Open(name); err == nil || !strings.Contains(err.Error(), "failed to open asset "+name) {
+			t.Errorf("opening %v: expected an error, got %v", name, err)
+		}
+	}
+}
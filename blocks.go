@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const ( //the ways World.Update can move cells
+	UPDATE_MOVE  = iota //each cell moves itself in place with MoveCell, in the world's scan order
+	UPDATE_BLOCK        //2x2x2 Margolus blocks that shift by one cell each tick, every block is updated on its own
+)
+
+var updateModeNames = []string{"move", "block"}
+
+// UpdateModeName gets the name of the update mode
+func UpdateModeName(mode int) string {
+	if mode >= 0 && mode < len(updateModeNames) {
+		return updateModeNames[mode]
+	}
+	return fmt.Sprintf("mode %v", mode)
+}
+
+// ParseUpdateMode gets the update mode called name
+func ParseUpdateMode(name string) (int, error) {
+	for mode, modeName := range updateModeNames {
+		if strings.EqualFold(name, modeName) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown update mode %q, should be one of %v", name, strings.Join(updateModeNames, ", "))
+}
+
+// SetUpdateMode switches between the MoveCell and block rules
+func (w *World) SetUpdateMode(mode int) {
+	w.UpdateMode = mode
+	if w.Recorder != nil {
+		w.Recorder.RecordUpdateMode(w.Tick, mode)
+	}
+}
+
+// blockRand is a tiny random number generator seeded per block, so blocks don't share any state and
+// give the same results whatever order or goroutine they're updated on.
+// It only uses 32 bit maths so the GPU backend can make exactly the same numbers.
+type blockRand struct {
+	state uint32
+}
+
+func makeBlockRand(seed int64, tick, x, y, z int) blockRand {
+	r := blockRand{state: blockSeed(seed)}
+	for _, n := range []int{tick, x, y, z} {
+		r.state = hash32(r.state ^ uint32(n))
+	}
+	return r
+}
+
+// blockSeed squashes the world's seed down to 32 bits
+func blockSeed(seed int64) uint32 {
+	return hash32(uint32(seed) ^ hash32(uint32(uint64(seed)>>32)))
+}
+
+// hash32 is the lowbias32 integer hash
+func hash32(x uint32) uint32 {
+	x ^= x >> 16
+	x *= 0x7feb352d
+	x ^= x >> 15
+	x *= 0x846ca68b
+	x ^= x >> 16
+	return x
+}
+
+func (r *blockRand) next() uint32 {
+	r.state = hash32(r.state + 0x9e3779b9)
+	return r.state
+}
+
+// intn gets a number from 0 to n-1
+func (r *blockRand) intn(n int) int {
+	return int(r.next() % uint32(n))
+}
+
+// shuffle fills order with 0 to len(order)-1 in a random order
+func (r *blockRand) shuffle(order []int) {
+	for i := range order {
+		j := r.intn(i + 1)
+		order[i] = order[j]
+		order[j] = i
+	}
+}
+
+// updateBlocks runs one tick of the block rules, the block grid is shifted by one cell on odd ticks
+func (w *World) updateBlocks() {
+	//sources aren't part of the block rules, they just drop their cell in first
+	for x := 0; x < w.Width; x++ {
+		for y := 0; y < w.Height; y++ {
+			for z := 0; z < w.Depth; z++ {
+				if w.Cells[x][y][z].Type == SOURCE {
+					w.updateSource(x, y, z)
+				}
+			}
+		}
+	}
+
+	offset := w.Tick % 2
+	slab := func(blockX int) {
+		for blockY := -offset; blockY < w.Height; blockY += 2 {
+			for blockZ := -offset; blockZ < w.Depth; blockZ += 2 {
+				w.updateBlock(blockX, blockY, blockZ)
+			}
+		}
+	}
+
+	if w.Checker != nil { //the checker isn't safe to share between goroutines
+		for blockX := -offset; blockX < w.Width; blockX += 2 {
+			slab(blockX)
+		}
+		return
+	}
+
+	//blocks never overlap so slabs of them can run at the same time
+	slabs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for blockX := range slabs {
+				slab(blockX)
+			}
+		}()
+	}
+	for blockX := -offset; blockX < w.Width; blockX += 2 {
+		slabs <- blockX
+	}
+	close(slabs)
+	wg.Wait()
+}
+
+// updateBlock applies the rules to the 2x2x2 block with its low corner at x,y,z.
+// Cells in the block are numbered dx | dy<<1 | dz<<2, anything outside the world counts as solid.
+func (w *World) updateBlock(x, y, z int) {
+	var pos [8][3]int
+	var types [8]int
+	occupied := 0
+	for i := range pos {
+		pos[i] = [3]int{x + i&1, y + i>>1&1, z + i>>2&1}
+		types[i] = WALL
+		if w.IndexInRange(pos[i][0], pos[i][1], pos[i][2]) {
+			types[i] = w.Cells[pos[i][0]][pos[i][1]][pos[i][2]].Type
+			if types[i] == DIRT || types[i] == WATER {
+				occupied++
+			}
+		}
+	}
+	if occupied == 0 { //nothing that can move
+		return
+	}
+
+	rng := makeBlockRand(w.Seed, w.Tick, x, y, z)
+	var moved [8]bool
+	free := func(i int) bool { return types[i] == AIR || types[i] == SINK }
+	move := func(from, to int) {
+		w.SwapCells(pos[from][0], pos[from][1], pos[from][2], pos[to][0], pos[to][1], pos[to][2])
+		if types[to] == SINK {
+			types[from] = AIR
+		} else {
+			types[from], types[to] = types[to], types[from]
+		}
+		moved[to] = true
+	}
+	// pick moves from to one of the targets that are free, returns false if none are
+	pick := func(from int, targets []int) bool {
+		var options [3]int
+		count := 0
+		for _, target := range targets {
+			if free(target) {
+				options[count] = target
+				count++
+			}
+		}
+		if count == 0 {
+			return false
+		}
+		move(from, options[rng.intn(count)])
+		return true
+	}
+
+	//falling straight down
+	for column := 0; column < 4; column++ {
+		top, bottom := column&1|2|column>>1<<2, column&1|column>>1<<2
+		if (types[top] == DIRT || types[top] == WATER) && free(bottom) {
+			move(top, bottom)
+		}
+	}
+
+	//cells in the top layer that couldn't fall slide down into the bottom of another column,
+	//going through them in a random order so no side of the block is favoured
+	var columns [4]int
+	rng.shuffle(columns[:])
+	for _, column := range columns {
+		top := column&1 | 2 | column>>1<<2
+		if moved[top] || (types[top] != DIRT && types[top] != WATER) {
+			continue
+		}
+		bottom := top &^ 2
+		pick(top, []int{bottom ^ 1, bottom ^ 4, bottom ^ 5})
+	}
+
+	//water that's settled spreads sideways within its layer
+	var cells [8]int
+	rng.shuffle(cells[:])
+	for _, cell := range cells {
+		if moved[cell] || types[cell] != WATER {
+			continue
+		}
+		pick(cell, []int{cell ^ 1, cell ^ 4, cell ^ 5})
+	}
+}
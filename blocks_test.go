@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBlockUpdateSymmetry(t *testing.T) {
+	for _, cellType := range []int{DIRT, WATER} {
+		offsetX, offsetZ := pileOffset(SCAN_ASCENDING, UPDATE_BLOCK, cellType)
+		if math.Abs(offsetX) > 0.5 || math.Abs(offsetZ) > 0.5 {
+			t.Errorf("%v pile with the block rules is off centre by %.2f, %.2f", CellTypeName(cellType), offsetX, offsetZ)
+		}
+	}
+}
+
+// TestBlockUpdateParallel checks updating blocks on many goroutines gives the same world as updating them one by one
+func TestBlockUpdateParallel(t *testing.T) {
+	makeScene := func() *World {
+		w := MakeWorld(20, 16, 20)
+		w.SetSeed(7)
+		w.UpdateMode = UPDATE_BLOCK
+		w.FillBox(0, 0, 0, 19, 0, 19, WALL)
+		w.FillSphere(6, 10, 6, 4, DIRT)
+		w.FillSphere(13, 10, 13, 4, WATER)
+		w.AddSource(10, 15, 10, WATER, 0.5)
+		w.AddCell(3, 1, 15, SINK)
+		return w
+	}
+	serial, parallel := makeScene(), makeScene()
+	serial.EnableInvariantChecks()
+	for i := 0; i < 100; i++ {
+		serial.Update()
+		parallel.Update()
+		if err := serial.Checker.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if serial.HashCells() != parallel.HashCells() {
+		t.Errorf("parallel block updates diverged from serial ones")
+	}
+}
+
+// TestBlockDirtPileSlope checks the block rules still let dirt settle into a pile rather than a column
+func TestBlockDirtPileSlope(t *testing.T) {
+	w := MakeWorld(15, 12, 15)
+	w.SetSeed(1)
+	w.UpdateMode = UPDATE_BLOCK
+	w.FillBox(7, 0, 7, 7, 11, 7, DIRT)
+	for i := 0; i < 100; i++ {
+		w.Update()
+	}
+	height := 0
+	for y := 0; y < w.Height && w.Cells[7][y][7].Type == DIRT; y++ {
+		height++
+	}
+	if height > 6 {
+		t.Errorf("column of 12 dirt is still %v high", height)
+	}
+	if count := w.CountCells(DIRT); count != 12 {
+		t.Errorf("pile has %v dirt, want 12", count)
+	}
+}
+
+func TestParseUpdateMode(t *testing.T) {
+	for mode, name := range updateModeNames {
+		if got, err := ParseUpdateMode(name); err != nil || got != mode {
+			t.Errorf("ParseUpdateMode(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseUpdateMode("sideways"); err == nil {
+		t.Error("expected an error for an unknown update mode")
+	}
+}
+
+func TestReplaceWorldKeepsUpdateMode(t *testing.T) {
+	oldConfig, oldWorld := config, world
+	defer func() { config, world = oldConfig, oldWorld }()
+	config = DefaultConfig()
+	world = MakeWorld(4, 4, 4)
+	world.SetUpdateMode(UPDATE_BLOCK) //as if switched with M, the config still has its default
+
+	replaceWorld(MakeWorld(4, 4, 4))
+	if world.UpdateMode != UPDATE_BLOCK {
+		t.Errorf("the new world updates with the %v rules, want the block rules picked for the old one", UpdateModeName(world.UpdateMode))
+	}
+}
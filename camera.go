@@ -97,6 +97,14 @@ func (c *Camera) ProcessMouseScroll(yOffset float32)  {
 	c.Zoom = glm.Clamp(c.Zoom, 1.0, 45.0)
 }
 
+// LookAt turns the camera to face target, looking straight up or down is kept just off vertical like the mouse
+func (c *Camera) LookAt(target glm.Vec3) {
+	direction := target.Sub(c.Position).Normalize()
+	c.Pitch = glm.Clamp(glm.RadToDeg(math32.Asin(direction.Y())), -89.0, 89.0)
+	c.Yaw = glm.RadToDeg(math32.Atan2(direction.Z(), direction.X()))
+	c.updateCameraVectors()
+}
+
 // updateCameraVectors calculates the front amera vectors euler angles
 func (c *Camera) updateCameraVectors() {
 	yawRad, pitchRad := glm.DegToRad(c.Yaw), glm.DegToRad(c.Pitch)
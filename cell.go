@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/go-gl/gl/v4.6-core/gl"
 	glm "github.com/go-gl/mathgl/mgl32"
 )
@@ -10,33 +13,56 @@ const ( //cell types
 	DIRT
 	WALL
 	WATER
+	SOURCE //spawns its Emit type into the cell below it
+	SINK   //deletes any cell that moves into it
 )
 
+// cellTypeNames are the names of each cell type, used by scene scripts and debug output
+var cellTypeNames = []string{"air", "dirt", "wall", "water", "source", "sink"}
+
+// CellTypeName gets the name of the cell type
+func CellTypeName(cellType int) string {
+	if cellType >= 0 && cellType < len(cellTypeNames) {
+		return cellTypeNames[cellType]
+	}
+	return fmt.Sprintf("type %v", cellType)
+}
+
+// ParseCellType gets the cell type called name
+func ParseCellType(name string) (int, error) {
+	for cellType, typeName := range cellTypeNames {
+		if strings.EqualFold(name, typeName) {
+			return cellType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown cell type %q", name)
+}
+
 type Cell struct {
 	PosX, PosY int32 //shouldn't matter since using a grid
 	Type int //the cell type, should be zero'd at AIR
+	Emit int //the cell type a SOURCE spawns
+	Rate float32 //how many cells a SOURCE spawns per tick, can be fractional
+	Charge float32 //how far the SOURCE is through spawning its next cell
 	// put some other stuff here
 }
 
-// Draw draws the cell with the specified translation
-func (c *Cell) Draw(posX, posY, posZ float32, shader *shader)  {
+// Draw draws the cell with the specified translation and scale
+func (c *Cell) Draw(posX, posY, posZ, scale float32, shader *shader)  {
 	if c.Type != AIR {
 		switch c.Type {
-		case DIRT: 
+		case DIRT, WALL, SOURCE, SINK:
 			shader.SetBool("Water", false)
-			model := glm.Ident4()
-			model = model.Mul4(glm.Translate3D(posX, posY, posZ))
-			model = model.Mul4(glm.Scale3D(CELL_SIZE_SCALAR, CELL_SIZE_SCALAR, CELL_SIZE_SCALAR))
-			shader.SetMat4("model", &model)
-			gl.DrawArrays(gl.TRIANGLES, 0, 36)
-
+			materials.Apply(shader, c.Type)
 		case WATER:
 			shader.SetBool("Water", true)
-			model := glm.Ident4()
-			model = model.Mul4(glm.Translate3D(posX, posY, posZ))
-			model = model.Mul4(glm.Scale3D(CELL_SIZE_SCALAR, CELL_SIZE_SCALAR, CELL_SIZE_SCALAR))
-			shader.SetMat4("model", &model)
-			gl.DrawArrays(gl.TRIANGLES, 0, 36)
+		default:
+			return
 		}
+		model := glm.Ident4()
+		model = model.Mul4(glm.Translate3D(posX, posY, posZ))
+		model = model.Mul4(glm.Scale3D(scale, scale, scale))
+		shader.SetMat4("model", &model)
+		gl.DrawArrays(gl.TRIANGLES, 0, 36)
 	}
 }
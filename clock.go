@@ -0,0 +1,62 @@
+package main
+
+const (
+	TICK_RATE           = 60   //simulation ticks per second at 1x speed
+	MIN_TICK_SPEED      = 0.25 //slowest speed multiplier
+	MAX_TICK_SPEED      = 16   //fastest speed multiplier
+	MAX_TICKS_PER_FRAME = 32   //stops the sim from spiralling when a frame takes too long
+)
+
+// TickClock decides how many simulation ticks to run each frame so the sim speed doesn't depend on the frame rate
+type TickClock struct {
+	TickRate     float32 //ticks per second at 1x
+	Speed        float32 //multiplier on TickRate
+	Paused       bool
+	accumulator  float32 //how many ticks worth of time hasn't been run yet
+	pendingSteps int     //single steps requested while paused
+}
+
+func MakeTickClock(tickRate float32) *TickClock {
+	return &TickClock{TickRate: tickRate, Speed: 1}
+}
+
+// Advance adds deltaTime seconds to the clock and returns how many ticks should be run
+func (c *TickClock) Advance(deltaTime float32) int {
+	ticks := c.pendingSteps
+	c.pendingSteps = 0
+	if c.Paused {
+		return ticks
+	}
+
+	c.accumulator += deltaTime * c.TickRate * c.Speed
+	for c.accumulator >= 1 && ticks < MAX_TICKS_PER_FRAME {
+		c.accumulator--
+		ticks++
+	}
+	if ticks == MAX_TICKS_PER_FRAME { //we're behind so just drop the leftover time
+		c.accumulator = 0
+	}
+	return ticks
+}
+
+// TogglePause pauses or unpauses the clock
+func (c *TickClock) TogglePause() {
+	c.Paused = !c.Paused
+	c.accumulator = 0
+}
+
+// Step queues a single tick, pausing the clock if it isn't already
+func (c *TickClock) Step() {
+	c.Paused = true
+	c.pendingSteps++
+}
+
+// SpeedUp doubles the speed up to MAX_TICK_SPEED
+func (c *TickClock) SpeedUp() {
+	c.Speed = min(c.Speed*2, MAX_TICK_SPEED)
+}
+
+// SlowDown halves the speed down to MIN_TICK_SPEED
+func (c *TickClock) SlowDown() {
+	c.Speed = max(c.Speed/2, MIN_TICK_SPEED)
+}
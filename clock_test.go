@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTickClockAdvance(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		speed  float32
+		deltas []float32 //seconds passed each frame, at 8 ticks a second
+		want   []int     //ticks run each frame
+	}{
+		{"whole ticks", 1, []float32{0.25, 0.5}, []int{2, 4}},
+		{"leftover time carries over", 1, []float32{0.0625, 0.0625, 0.1875}, []int{0, 1, 1}},
+		{"faster", 4, []float32{0.25}, []int{8}},
+		{"slower", 0.25, []float32{0.25, 0.25}, []int{0, 1}},
+		{"behind drops the leftover", 1, []float32{5, 0.0625}, []int{MAX_TICKS_PER_FRAME, 0}},
+		{"under the limit keeps it", 1, []float32{3.9375, 0.0625}, []int{MAX_TICKS_PER_FRAME - 1, 1}},
+	} {
+		c := MakeTickClock(8)
+		c.Speed = test.speed
+		var got []int
+		for _, delta := range test.deltas {
+			got = append(got, c.Advance(delta))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%v: ran %v ticks, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTickClockPauseAndStep(t *testing.T) {
+	c := MakeTickClock(8)
+	c.Advance(0.0625) //half a tick that pausing should throw away
+	c.TogglePause()
+	if got := c.Advance(1); got != 0 {
+		t.Errorf("a paused clock ran %v ticks", got)
+	}
+
+	//steps queue up while paused and each runs exactly once
+	c.Step()
+	c.Step()
+	if got := c.Advance(1); got != 2 {
+		t.Errorf("two steps ran %v ticks", got)
+	}
+	if got := c.Advance(1); got != 0 {
+		t.Errorf("steps ran again on the next frame, %v ticks", got)
+	}
+
+	c.TogglePause()
+	if got := c.Advance(0.0625); got != 0 {
+		t.Errorf("unpausing kept time from before the pause, ran %v ticks", got)
+	}
+
+	//stepping a running clock pauses it
+	c.Step()
+	if !c.Paused {
+		t.Errorf("stepping didn't pause the clock")
+	}
+	if got := c.Advance(1); got != 1 {
+		t.Errorf("a step ran %v ticks", got)
+	}
+}
+
+func TestTickClockSpeedLimits(t *testing.T) {
+	c := MakeTickClock(TICK_RATE)
+	var speeds []float32
+	for i := 0; i < 6; i++ {
+		c.SpeedUp()
+		speeds = append(speeds, c.Speed)
+	}
+	if want := []float32{2, 4, 8, 16, 16, 16}; fmt.Sprint(speeds) != fmt.Sprint(want) {
+		t.Errorf("speeding up went %v, want %v", speeds, want)
+	}
+
+	speeds = nil
+	for i := 0; i < 8; i++ {
+		c.SlowDown()
+		speeds = append(speeds, c.Speed)
+	}
+	if want := []float32{8, 4, 2, 1, 0.5, 0.25, 0.25, 0.25}; fmt.Sprint(speeds) != fmt.Sprint(want) {
+		t.Errorf("slowing down went %v, want %v", speeds, want)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+
+	"sand3d/terrain"
+)
+
+// Config holds all the settings for a run, they come from an optional json config file and then the command line
+type Config struct {
+	ConfigFile     string  `json:"-"`
+	WindowWidth    int     `json:"window_width"`
+	WindowHeight   int     `json:"window_height"`
+	Fullscreen     bool    `json:"fullscreen"`
+	VSync          bool    `json:"vsync"`
+	FrameRate      int     `json:"frame_rate"` //0 means don't limit it
+	WorldSize      string  `json:"world_size"`
+	Seed           int64   `json:"seed"` //0 means pick one from the time
+	LoadFile       string  `json:"load_file"`
+	Script         string  `json:"script"`  //scene script to build the starting world with
+	Terrain        bool    `json:"terrain"` //start with generated terrain instead of an empty world
+	SeaLevel       float64 `json:"sea_level"`
+	Roughness      float64 `json:"roughness"`
+	Replay         string  `json:"replay"`
+	Headless       bool    `json:"headless"`
+	Ticks          int     `json:"ticks"`        //how many ticks to run when headless
+	OutFile        string  `json:"out_file"`     //where to save the world after a headless run
+	RenderFile     string  `json:"render"`       //draw the world offscreen after the ticks have run and save it here as a PNG
+	CameraPosition string  `json:"camera"`       //where -render looks from as x,y,z, empty frames the whole world
+	CameraTarget   string  `json:"look_at"`      //what -render looks at as x,y,z
+	Record         string  `json:"record"`       //a .gif or numbered PNG pattern to record frames to
+	RecordEvery    int     `json:"record_every"` //keep every Nth frame in the viewer, or every Nth tick with -render
+	TickRate       float64 `json:"tick_rate"`
+	ScanOrder      string  `json:"scan_order"`      //the order cells are updated in, see scanOrderNames
+	UpdateMode     string  `json:"update_mode"`     //the rules cells move with, see updateModeNames
+	LightDirection string  `json:"light_direction"` //the way the light shines as x,y,z
+	LightColour    string  `json:"light_colour"`    //as r,g,b from 0 to 1
+	AOStrength     float64 `json:"ao_strength"`     //how dark corners tucked against other cells get, 0 turns it off
+	Refraction     bool    `json:"refraction"`      //bend what's seen through the water with its waves
+	Shadows        bool    `json:"shadows"`
+	ShadowBias     float64 `json:"shadow_bias"`      //depth added before comparing against the shadow map, raise it if faces speckle
+	GPU            bool    `json:"gpu"`              //run the block rules and drawing on the GPU
+	Invariants     bool    `json:"check_invariants"` //check every update for lost or duplicated cells
+	AssetDir       string  `json:"asset_dir"`        //overrides the embedded assets, empty means just use those
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		WindowWidth:    WIN_WIDTH,
+		WindowHeight:   WIN_HEIGHT,
+		FrameRate:      FRAME_RATE,
+		WorldSize:      DEFAULT_WORLD_SIZE,
+		Ticks:          TICK_RATE * 10,
+		TickRate:       TICK_RATE,
+		ScanOrder:      ScanOrderName(SCAN_ALTERNATE),
+		UpdateMode:     UpdateModeName(UPDATE_MOVE),
+		LightDirection: formatVec3(DefaultLight().Direction),
+		LightColour:    formatVec3(DefaultLight().Colour),
+		AOStrength:     DEFAULT_AO_STRENGTH,
+		Refraction:     true,
+		Shadows:        true,
+		ShadowBias:     DEFAULT_SHADOW_BIAS,
+		CameraTarget:   formatVec3(glm.Vec3{}),
+		RecordEvery:    1,
+		SeaLevel:       terrain.DefaultSettings(0).SeaLevel,
+		Roughness:      terrain.DefaultSettings(0).Roughness,
+	}
+}
+
+// flagSet makes a flag set that writes into c, so whatever is already in c acts as the defaults
+func (c *Config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("sand3d", flag.ContinueOnError)
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "json config file to load settings from, flags override it")
+	fs.IntVar(&c.WindowWidth, "width", c.WindowWidth, "window width")
+	fs.IntVar(&c.WindowHeight, "height", c.WindowHeight, "window height")
+	fs.BoolVar(&c.Fullscreen, "fullscreen", c.Fullscreen, "run fullscreen")
+	fs.BoolVar(&c.VSync, "vsync", c.VSync, "sync buffer swaps to the display")
+	fs.IntVar(&c.FrameRate, "fps", c.FrameRate, "frame rate limit, 0 for none")
+	fs.StringVar(&c.WorldSize, "size", c.WorldSize, "world size as WIDTHxHEIGHTxDEPTH, or a single number for a cube, up to 256x256x256 cells in all")
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "random seed for the simulation, 0 picks one from the time")
+	fs.StringVar(&c.LoadFile, "load", c.LoadFile, "world save to start from")
+	fs.StringVar(&c.Script, "script", c.Script, "scene script to build the starting world with")
+	fs.BoolVar(&c.Terrain, "terrain", c.Terrain, "start with generated terrain, the seed picks the landscape")
+	fs.Float64Var(&c.SeaLevel, "sealevel", c.SeaLevel, "fraction of the world's height that generated lakes fill up to")
+	fs.Float64Var(&c.Roughness, "roughness", c.Roughness, "how jagged generated terrain is, from 0 to 1")
+	fs.StringVar(&c.Replay, "replay", c.Replay, "play back the replay file at this path")
+	fs.BoolVar(&c.Headless, "headless", c.Headless, "run without a window, either playing -replay or running -ticks ticks")
+	fs.IntVar(&c.Ticks, "ticks", c.Ticks, "how many ticks to run when headless, scene scripts run their own instead")
+	fs.StringVar(&c.OutFile, "out", c.OutFile, "where to save the world after a headless run")
+	fs.StringVar(&c.RenderFile, "render", c.RenderFile, "run -ticks ticks then draw the world without showing a window and save it to this PNG")
+	fs.StringVar(&c.CameraPosition, "camera", c.CameraPosition, "where -render looks from as x,y,z with the world centred on 0,0,0, empty frames the whole world")
+	fs.StringVar(&c.CameraTarget, "lookat", c.CameraTarget, "what -render looks at as x,y,z")
+	fs.StringVar(&c.Record, "record", c.Record, "record frames to this .gif, or to numbered PNGs given a pattern like frames/%04d.png. F8 starts and stops it in the viewer, -render records every tick")
+	fs.IntVar(&c.RecordEvery, "recordevery", c.RecordEvery, "keep every Nth frame when recording in the viewer, or every Nth tick with -render")
+	fs.Float64Var(&c.TickRate, "tickrate", c.TickRate, "simulation ticks per second at 1x speed")
+	fs.StringVar(&c.ScanOrder, "scan", c.ScanOrder, "order cells are updated in: "+strings.Join(scanOrderNames, ", "))
+	fs.StringVar(&c.UpdateMode, "update", c.UpdateMode, "rules cells move with: "+strings.Join(updateModeNames, ", "))
+	fs.StringVar(&c.LightDirection, "lightdir", c.LightDirection, "the way the light shines as x,y,z")
+	fs.StringVar(&c.LightColour, "lightcolour", c.LightColour, "the light's colour as r,g,b from 0 to 1")
+	fs.Float64Var(&c.AOStrength, "ao", c.AOStrength, "how dark corners tucked against other cells get, from 0 to 1")
+	fs.BoolVar(&c.Refraction, "refraction", c.Refraction, "bend what's seen through the water with its waves")
+	fs.BoolVar(&c.Shadows, "shadows", c.Shadows, "draw shadows from the light")
+	fs.Float64Var(&c.ShadowBias, "shadowbias", c.ShadowBias, "depth added before comparing against the shadow map, raise it if faces speckle with shadow")
+	fs.BoolVar(&c.GPU, "gpu", c.GPU, "run the simulation on the GPU with compute shaders, this always uses the block rules")
+	fs.BoolVar(&c.Invariants, "checkinvariants", c.Invariants, "debug mode that checks every update for lost or duplicated cells")
+	fs.StringVar(&c.AssetDir, "assets", c.AssetDir, "directory of shaders and textures to use instead of the built in ones, shaders edited in it are reloaded. Without it the viewer uses ./data if it's there")
+	return fs
+}
+
+// ParseConfig builds the config from args, loading the -config file first if there is one
+func ParseConfig(args []string) (*Config, error) {
+	config := DefaultConfig()
+	if err := config.flagSet().Parse(args); err != nil {
+		return nil, err
+	}
+	if config.ConfigFile == "" {
+		return config, config.validate()
+	}
+
+	fileConfig := DefaultConfig()
+	if err := fileConfig.loadFile(config.ConfigFile); err != nil {
+		return nil, err
+	}
+	fileConfig.ConfigFile = config.ConfigFile
+	if err := fileConfig.flagSet().Parse(args); err != nil { //parse again so the flags win
+		return nil, err
+	}
+	return fileConfig, fileConfig.validate()
+}
+
+// loadFile loads the json config at path over the top of c
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config %v: %v", path, err)
+	}
+	return nil
+}
+
+// validate checks the settings make sense
+func (c *Config) validate() error {
+	switch {
+	case c.WindowWidth <= 0 || c.WindowHeight <= 0:
+		return fmt.Errorf("invalid window size %vx%v", c.WindowWidth, c.WindowHeight)
+	case c.FrameRate < 0:
+		return fmt.Errorf("invalid frame rate %v", c.FrameRate)
+	case c.TickRate <= 0:
+		return fmt.Errorf("invalid tick rate %v", c.TickRate)
+	case c.Ticks < 0:
+		return fmt.Errorf("invalid tick count %v", c.Ticks)
+	case c.SeaLevel < 0 || c.SeaLevel > 1:
+		return fmt.Errorf("sea level %v should be between 0 and 1", c.SeaLevel)
+	case c.Roughness < 0 || c.Roughness > 1:
+		return fmt.Errorf("roughness %v should be between 0 and 1", c.Roughness)
+	case c.AOStrength < 0 || c.AOStrength > 1:
+		return fmt.Errorf("ao strength %v should be between 0 and 1", c.AOStrength)
+	case c.ShadowBias < 0 || c.ShadowBias > 1:
+		return fmt.Errorf("shadow bias %v should be between 0 and 1", c.ShadowBias)
+	case c.GPU && c.Headless:
+		return fmt.Errorf("the GPU backend needs a window, it can't run headless")
+	case c.GPU && c.Invariants:
+		return fmt.Errorf("-checkinvariants can't check the GPU backend, its ticks never come back to the CPU")
+	case c.RenderFile != "" && (c.GPU || c.Headless || c.Replay != ""):
+		return fmt.Errorf("-render can't be used with -gpu, -headless or -replay")
+	case c.RecordEvery < 1:
+		return fmt.Errorf("invalid record interval %v", c.RecordEvery)
+	case c.Record != "" && c.Headless:
+		return fmt.Errorf("-headless doesn't draw anything to record, use -render to record without a window")
+	case c.Record != "" && c.RenderFile != "" && c.Script != "":
+		return fmt.Errorf("-render records the -ticks it runs, a -script runs its ticks before there's anything to record")
+	}
+	if _, _, _, err := parseWorldSize(c.WorldSize); err != nil {
+		return err
+	}
+	if _, err := ParseScanOrder(c.ScanOrder); err != nil {
+		return err
+	}
+	if _, err := ParseUpdateMode(c.UpdateMode); err != nil {
+		return err
+	}
+	if direction, err := parseVec3(c.LightDirection); err != nil {
+		return fmt.Errorf("invalid light direction: %v", err)
+	} else if direction.Len() == 0 {
+		return fmt.Errorf("the light direction can't be 0,0,0")
+	}
+	if _, err := parseVec3(c.LightColour); err != nil {
+		return fmt.Errorf("invalid light colour: %v", err)
+	}
+	target, err := parseVec3(c.CameraTarget)
+	if err != nil {
+		return fmt.Errorf("invalid camera target: %v", err)
+	}
+	if c.CameraPosition != "" {
+		if position, err := parseVec3(c.CameraPosition); err != nil {
+			return fmt.Errorf("invalid camera position: %v", err)
+		} else if position == target {
+			return fmt.Errorf("the camera can't look at where it is")
+		}
+	}
+	if c.Record != "" {
+		if err := checkFrameRecordingPath(c.Record); err != nil {
+			return err
+		}
+	}
+	if c.AssetDir != "" {
+		if info, err := os.Stat(c.AssetDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("asset directory %v doesn't exist", c.AssetDir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigDefaults(t *testing.T) {
+	c, err := ParseConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *c != *DefaultConfig() {
+		t.Errorf("no arguments gave %+v, want the defaults", *c)
+	}
+}
+
+// TestParseConfigPrecedence checks the file overrides the defaults and flags override the file, whichever side of
+// -config they're on
+func TestParseConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"window_width": 640, "window_height": 480, "seed": 7, "scan_order": "random"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ParseConfig([]string{"-seed", "9", "-config", path, "-height", "200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.WindowWidth != 640 || c.ScanOrder != "random" {
+		t.Errorf("the file's settings weren't used: width %v, scan order %v", c.WindowWidth, c.ScanOrder)
+	}
+	if c.Seed != 9 || c.WindowHeight != 200 {
+		t.Errorf("the flags didn't win over the file: seed %v, height %v", c.Seed, c.WindowHeight)
+	}
+	if c.TickRate != DefaultConfig().TickRate || c.ConfigFile != path {
+		t.Errorf("settings in neither should be the defaults: tick rate %v, config file %v", c.TickRate, c.ConfigFile)
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.json")
+	os.WriteFile(broken, []byte(`{"seed": "seven"}`), 0644)
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`{"tick_rate": -1}`), 0644)
+
+	for path, want := range map[string]string{
+		filepath.Join(dir, "missing.json"): "failed to read config",
+		broken:                             "failed to parse config",
+		invalid:                            "invalid tick rate",
+	} {
+		if _, err := ParseConfig([]string{"-config", path}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loading %v: expected an error containing %q, got %v", filepath.Base(path), want, err)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		want string //part of the error, empty if it's fine
+	}{
+		{[]string{"-width", "0"}, "invalid window size"},
+		{[]string{"-fps", "-1"}, "invalid frame rate"},
+		{[]string{"-tickrate", "0"}, "invalid tick rate"},
+		{[]string{"-ticks", "-5"}, "invalid tick count"},
+		{[]string{"-sealevel", "1.5"}, "sea level"},
+		{[]string{"-roughness", "-0.1"}, "roughness"},
+		{[]string{"-ao", "2"}, "ao strength"},
+		{[]string{"-shadowbias", "-1"}, "shadow bias"},
+		{[]string{"-gpu", "-headless"}, "can't run headless"},
+		{[]string{"-gpu", "-checkinvariants"}, "can't check the GPU backend"},
+		{[]string{"-render", "a.png", "-gpu"}, "-render can't be used"},
+		{[]string{"-render", "a.png", "-replay", "a.rec"}, "-render can't be used"},
+		{[]string{"-size", "10x10"}, "should look like"},
+		{[]string{"-size", "0"}, "invalid world size"},
+		{[]string{"-size", "60000"}, "too big"},
+		{[]string{"-size", "1024x1024x1024"}, "too big"},
+		{[]string{"-scan", "sideways"}, "unknown scan order"},
+		{[]string{"-update", "teleport"}, "unknown update mode"},
+		{[]string{"-lightdir", "0,0,0"}, "can't be 0,0,0"},
+		{[]string{"-lightcolour", "red"}, "invalid light colour"},
+		{[]string{"-camera", "1,2"}, "invalid camera position"},
+		{[]string{"-camera", "1,1,1", "-lookat", "1,1,1"}, "look at where it is"},
+		{[]string{"-recordevery", "0"}, "invalid record interval"},
+		{[]string{"-record", "frames.png"}, "number pattern"},
+		{[]string{"-record", "run.gif", "-headless"}, "doesn't draw anything"},
+		{[]string{"-record", "run.gif", "-render", "out.png", "-script", "scene.txt"}, "-script runs its ticks"},
+		{[]string{"-assets", filepath.Join(t.TempDir(), "missing")}, "doesn't exist"},
+		{[]string{"-size", "16x8x4", "-scan", "random", "-camera", "1,2,3", "-record", "f%03d.png"}, ""},
+	} {
+		_, err := ParseConfig(test.args)
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%v: %v", test.args, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("%v: expected an error containing %q, got %v", test.args, test.want, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+#version 460 core
+// draws the cells picked out by sim_visible.comp straight from the GPU's cell buffer, one instance per cell
+// the cell types and CELL_TYPE_MASK are defined by gpu.go
+layout (location = 0) in vec3 aPos;
+layout (location = 1) in vec2 aTexCoord;
+layout (location = 2) in vec3 aNormal;
+
+layout (std430, binding = 0) readonly buffer CellBuffer { uint cells[]; };
+layout (std430, binding = 2) readonly buffer InstanceBuffer { uint instances[]; };
+
+out vec2 TexCoord;
+out vec3 FragPos;
+out vec3 Normal;
+out vec4 CellTint;
+flat out int CellWater;
+flat out int TextureLayer;
+out float Occlusion;
+out float WaterDepth;
+out float Surface;
+
+uniform mat4 view;
+uniform mat4 projection;
+uniform ivec3 Size;
+uniform float CellSize;
+uniform vec4 MaterialTints[CELL_TYPE_COUNT]; // indexed by cell type, see Materials.ApplyAll
+uniform int MaterialLayers[CELL_TYPE_COUNT];
+uniform float Time;
+uniform float WaveHeight; // as a fraction of a cell
+
+// cellTypeAt gets the type of the cell at pos, anything outside the world counts as air
+uint cellTypeAt(ivec3 pos)
+{
+  if (any(lessThan(pos, ivec3(0))) || any(greaterThanEqual(pos, Size))) {
+    return AIR;
+  }
+  return cells[(pos.x * Size.y + pos.y) * Size.z + pos.z] & CELL_TYPE_MASK;
+}
+
+// wave gets the height of the water's waves at p, in cells along x and z, from -1 to 1, the same as in world.vs
+float wave(vec2 p)
+{
+  return 0.5 * sin(p.x * 1.3 + Time * 1.7) + 0.3 * sin(p.y * 1.1 - Time * 1.3) + 0.2 * sin((p.x + p.y) * 0.7 + Time * 2.1);
+}
+
+// waterColumnDepth counts the unbroken run of water the cell is in, like World.waterColumnDepth
+float waterColumnDepth(ivec3 cell)
+{
+  int depth = 1;
+  for (int y = cell.y + 1; y < Size.y && cellTypeAt(ivec3(cell.x, y, cell.z)) == WATER; y++) {
+    depth++;
+  }
+  for (int y = cell.y - 1; y >= 0 && cellTypeAt(ivec3(cell.x, y, cell.z)) == WATER; y--) {
+    depth++;
+  }
+  return float(depth);
+}
+
+// occludes gets whether the cell at pos shades the faces next to it, like World.occludes
+bool occludes(ivec3 pos)
+{
+  uint cellType = cellTypeAt(pos);
+  return cellType != AIR && cellType != WATER;
+}
+
+// occlusion works out this vertex's corner's level the same way as World.CornerAO, scaled from 0 to 1
+float occlusion(ivec3 cell)
+{
+  int axis = abs(aNormal.x) > 0.5 ? 0 : (abs(aNormal.y) > 0.5 ? 1 : 2);
+  int u = axis == 0 ? 1 : 0;
+  int v = axis == 2 ? 1 : 2;
+
+  ivec3 front = cell + ivec3(aNormal);
+  ivec3 side1 = front;
+  side1[u] += aPos[u] > 0.0 ? 1 : -1;
+  ivec3 side2 = front;
+  side2[v] += aPos[v] > 0.0 ? 1 : -1;
+  ivec3 diagonal = side1;
+  diagonal[v] = side2[v];
+
+  bool occluded1 = occludes(side1);
+  bool occluded2 = occludes(side2);
+  if (occluded1 && occluded2) {
+    return 0.0;
+  }
+  return float(3 - int(occluded1) - int(occluded2) - int(occludes(diagonal))) / 3.0;
+}
+
+void main()
+{
+  int index = int(instances[gl_InstanceID]);
+  ivec3 cell = ivec3(index / (Size.y * Size.z), (index / Size.z) % Size.y, index % Size.z);
+  vec3 centre = (vec3(cell) + 0.5 - vec3(Size) * 0.5) * CellSize; // the same as World.CellPosition
+  FragPos = centre + aPos * CellSize;
+  uint cellType = cells[index] & CELL_TYPE_MASK;
+  WaterDepth = 0.0;
+  Surface = 0.0;
+  if (cellType == WATER) { // the same as World.WaterMesh
+    WaterDepth = waterColumnDepth(cell);
+    if (aPos.y > 0.0 && cellTypeAt(cell + ivec3(0, 1, 0)) == AIR) {
+      Surface = 1.0;
+      FragPos.y += (wave(FragPos.xz / CellSize) - 1.0) * 0.5 * WaveHeight * CellSize;
+    }
+  }
+  gl_Position = projection * view * vec4(FragPos, 1.0);
+  TexCoord = aTexCoord;
+  Normal = aNormal;
+  Occlusion = occlusion(cell);
+
+  // the same materials as Cell.Draw
+  CellWater = int(cellType == WATER);
+  if (cellType == WATER && cellTypeAt(cell + ivec3(aNormal)) != AIR) {
+    // like World.waterFaceVisible, only water's faces onto air are drawn, this one goes outside the clip volume
+    gl_Position = vec4(2.0, 2.0, 2.0, 1.0);
+  }
+  CellTint = MaterialTints[cellType];
+  TextureLayer = MaterialLayers[cellType];
+}
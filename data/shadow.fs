@@ -0,0 +1,6 @@
+#version 330 core
+// the shadow map only needs depth, which is written without a fragment shader doing anything
+
+void main()
+{
+}
@@ -0,0 +1,12 @@
+#version 330 core
+// draws cells from the light's point of view into the shadow map, see shadow.go
+layout (location = 0) in vec3 aPos;
+
+uniform mat4 model;
+uniform mat4 view;
+uniform mat4 projection;
+
+void main()
+{
+	gl_Position = projection * view * model * vec4(aPos, 1.0f);
+}
@@ -2,16 +2,116 @@
 out vec4 FragColor;
 
 in vec2 TexCoord;
+in vec3 FragPos;
+in vec3 Normal;
+in vec4 CellTint;
+flat in int CellWater;
+flat in int TextureLayer;
+in float Occlusion; // 0 for a boxed in corner up to 1 for an open one
+in float WaterDepth; // in cells
+in float Surface; // 1 on the water's surface
 
 // texture samplers
-uniform sampler2D texture1;
-uniform bool Water;
+uniform sampler2DArray Textures; // a layer per material, see materials.go
+
+// the directional light, see light.go
+uniform vec3 LightDir; // the way the light is shining
+uniform vec3 LightColour;
+uniform float Ambient;
+uniform float Specular;
+uniform float Shininess;
+uniform vec3 ViewPos;
+uniform bool Unlit; // for lines like the bounding box
+uniform float AOStrength; // how dark fully occluded corners get
+
+// the shadow map, see shadow.go
+uniform bool Shadows;
+uniform sampler2D ShadowMap;
+uniform mat4 LightSpace; // world space to the shadow map's clip space
+uniform float ShadowBias;
+uniform int ShadowPCFRadius;
+
+// the water, see water.go
+uniform float Time;
+uniform float CellSize;
+uniform float WaveHeight; // as a fraction of a cell
+uniform bool Refraction; // draw what's behind the water bent by the waves instead of the water, see Renderer.Draw
+uniform sampler2D SceneColour; // what was drawn before the water
+uniform vec2 ScreenSize;
+uniform float RefractionStrength;
+
+// waveSlope gets the slope along x and z of wave in world.vs at p, in cells along x and z
+vec2 waveSlope(vec2 p)
+{
+  float diagonal = 0.2 * 0.7 * cos((p.x + p.y) * 0.7 + Time * 2.1);
+  return vec2(0.5 * 1.3 * cos(p.x * 1.3 + Time * 1.7) + diagonal, 0.3 * 1.1 * cos(p.y * 1.1 - Time * 1.3) + diagonal);
+}
+
+// shadow gets how much of the light reaches this fragment from 0 to 1, averaging nearby shadow map texels to
+// soften the edges
+float shadow(vec3 normal, vec3 toLight)
+{
+  if (!Shadows) {
+    return 1.0;
+  }
+  vec4 lightPos = LightSpace * vec4(FragPos, 1.0);
+  vec3 mapPos = lightPos.xyz / lightPos.w * 0.5 + 0.5;
+  if (mapPos.z > 1.0) { // past the far end of the map
+    return 1.0;
+  }
+  // faces side on to the light need more bias to not shadow themselves
+  float bias = ShadowBias * (1.0 + 4.0 * (1.0 - max(dot(normal, toLight), 0.0)));
+
+  vec2 texel = 1.0 / vec2(textureSize(ShadowMap, 0));
+  float lit = 0.0;
+  for (int x = -ShadowPCFRadius; x <= ShadowPCFRadius; x++) {
+    for (int y = -ShadowPCFRadius; y <= ShadowPCFRadius; y++) {
+      float closest = texture(ShadowMap, mapPos.xy + vec2(x, y) * texel).r;
+      lit += mapPos.z - bias > closest ? 0.0 : 1.0;
+    }
+  }
+  float samples = float((ShadowPCFRadius * 2 + 1) * (ShadowPCFRadius * 2 + 1));
+  return lit / samples;
+}
+
+vec3 lighting(vec3 colour, vec3 normal)
+{
+  vec3 toLight = normalize(-LightDir);
+  float diffuse = max(dot(normal, toLight), 0.0);
+
+  // blinn-phong highlight
+  vec3 toView = normalize(ViewPos - FragPos);
+  vec3 halfway = normalize(toLight + toView);
+  float specular = diffuse > 0.0 ? pow(max(dot(normal, halfway), 0.0), Shininess) * Specular : 0.0;
+
+  float ao = mix(1.0 - AOStrength, 1.0, Occlusion);
+  float lit = diffuse > 0.0 ? shadow(normal, toLight) : 1.0; // faces turned away from the light are dark already
+  return (colour * LightColour * (Ambient + diffuse * lit) + LightColour * specular * lit) * ao;
+}
 
 void main()
 {
-  if (Water) {
-    FragColor = vec4(0.0, 0.0, 1.0, 0.8);
-  } else {
-    FragColor = texture(texture1, TexCoord);
+  vec3 normal = normalize(Normal);
+  if (CellWater == 0) {
+    vec4 colour = texture(Textures, vec3(TexCoord, TextureLayer)) * CellTint;
+    FragColor = Unlit ? colour : vec4(lighting(colour.rgb, normal), colour.a);
+    return;
+  }
+
+  // deeper water is darker and lets less through
+  float deep = 1.0 - exp(-WaterDepth * 0.3);
+  vec4 colour = vec4(mix(vec3(0.25, 0.65, 0.9), vec3(0.0, 0.12, 0.4), deep), mix(0.45, 0.9, deep));
+
+  // ripple the surface's normal to match the waves world.vs moves it by, four times steeper than they really are
+  // so the highlights move about
+  vec2 slope = vec2(0.0);
+  if (Surface > 0.99 && normal.y > 0.5) {
+    slope = waveSlope(FragPos.xz / CellSize);
+    normal = normalize(vec3(-2.0 * WaveHeight * slope.x, 1.0, -2.0 * WaveHeight * slope.y));
+  }
+  if (Refraction) {
+    FragColor = vec4(texture(SceneColour, gl_FragCoord.xy / ScreenSize + slope * RefractionStrength).rgb, 1.0);
+    return;
   }
+  FragColor = vec4(lighting(colour.rgb, normal), colour.a);
 }
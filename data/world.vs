@@ -1,15 +1,64 @@
 #version 330 core
 layout (location = 0) in vec3 aPos;
 layout (location = 1) in vec2 aTexCoord;
+layout (location = 2) in vec3 aNormal;
+layout (location = 3) in vec2 aWater; // depth in cells and 1 on the surface, only the water mesh has it
 
 out vec2 TexCoord;
+out vec3 FragPos;
+out vec3 Normal;
+out vec4 CellTint;
+flat out int CellWater;
+flat out int TextureLayer;
+out float Occlusion;
+out float WaterDepth;
+out float Surface;
 
 uniform mat4 model;
 uniform mat4 view;
 uniform mat4 projection;
+uniform bool Water;
+uniform vec4 Tint;
+uniform int Layer; // the cell's material's layer in the texture array
+uniform uvec2 AO; // the cell's corner occlusion levels packed by World.CellAO
+uniform float Time;
+uniform float CellSize;
+uniform float WaveHeight; // as a fraction of a cell
+
+// wave gets the height of the water's waves at p, in cells along x and z, from -1 to 1, world.fs has its slope
+float wave(vec2 p)
+{
+	return 0.5 * sin(p.x * 1.3 + Time * 1.7) + 0.3 * sin(p.y * 1.1 - Time * 1.3) + 0.2 * sin((p.x + p.y) * 0.7 + Time * 2.1);
+}
+
+// occlusion gets this vertex's corner's level from AO, scaled from 0 to 1
+float occlusion()
+{
+	// the faces are in the same order as faceNormals and corners are numbered along the face's axes like faceAxes
+	int face = gl_VertexID / 6;
+	int axis = abs(aNormal.x) > 0.5 ? 0 : (abs(aNormal.y) > 0.5 ? 1 : 2);
+	int u = axis == 0 ? 1 : 0;
+	int v = axis == 2 ? 1 : 2;
+	int corner = int(aPos[u] > 0.0) | int(aPos[v] > 0.0) << 1;
+
+	int index = face * 4 + corner;
+	uint level = (AO[index / 16] >> uint(index % 16 * 2)) & 3u;
+	return float(level) / 3.0;
+}
 
 void main()
 {
-	gl_Position = projection * view * model * vec4(aPos, 1.0f);
+	FragPos = vec3(model * vec4(aPos, 1.0f));
+	if (aWater.y > 0.5) { // dip the surface down by the waves, never up into the cell above
+		FragPos.y += (wave(FragPos.xz / CellSize) - 1.0) * 0.5 * WaveHeight * CellSize;
+	}
+	gl_Position = projection * view * vec4(FragPos, 1.0f);
 	TexCoord = vec2(aTexCoord.x, aTexCoord.y);
+	Normal = mat3(transpose(inverse(model))) * aNormal;
+	CellTint = Tint;
+	TextureLayer = Layer;
+	CellWater = int(Water);
+	Occlusion = occlusion();
+	WaterDepth = aWater.x;
+	Surface = aWater.y;
 }
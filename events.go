@@ -1,6 +1,17 @@
 package main
 
-import "github.com/veandco/go-sdl2/sdl"
+import (
+	"fmt"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+
+	"sand3d/terrain"
+)
+
+const SAVE_PATH = "./world.sav"
+const SOURCE_RATE = 1.0 //cells per tick spawned by placed sources
+const SCREENSHOT_PATTERN = "./screenshot-%v.png" //filled in with the time
 
 func handleEvents() bool {
 	handleKeys(sdl.GetKeyboardState())
@@ -16,8 +27,19 @@ func handleEvents() bool {
 			handleMouseMovement(t)
 
 		case *sdl.MouseButtonEvent:
-			//handle mouse draw stuff here
-			
+			if t.Button == sdl.BUTTON_LEFT {
+				painting = t.State == sdl.PRESSED
+				if painting { //group the whole stroke into one undo
+					world.BeginEdit()
+				} else {
+					world.EndEdit()
+				}
+			}
+
+		case *sdl.KeyboardEvent:
+			if t.State == sdl.PRESSED && t.Repeat == 0 {
+				handleKeyPress(t.Keysym)
+			}
 		}
 	}
 	return false
@@ -48,6 +70,145 @@ func handleKeys(keys []uint8) {
 }
 
 
+// handleKeyPress handles keys that should only trigger once per press
+func handleKeyPress(key sdl.Keysym) {
+	ctrl := key.Mod&sdl.KMOD_CTRL != 0
+	switch {
+	case ctrl && key.Sym == sdl.K_z:
+		world.Undo()
+		return
+	case ctrl && key.Sym == sdl.K_y:
+		world.Redo()
+		return
+	}
+
+	switch key.Sym {
+	case sdl.K_0:
+		drawType = AIR
+	case sdl.K_1:
+		drawType = DIRT
+	case sdl.K_2:
+		drawType = WALL
+	case sdl.K_3:
+		drawType = WATER
+	case sdl.K_4:
+		drawType = SOURCE
+	case sdl.K_5:
+		drawType = SINK
+	case sdl.K_r: //swap what placed sources spawn
+		if sourceType == DIRT {
+			sourceType = WATER
+		} else {
+			sourceType = DIRT
+		}
+	case sdl.K_UP:
+		selectionY = min(selectionY+1, float32(world.Height-1))
+	case sdl.K_DOWN:
+		selectionY = max(selectionY-1, 0)
+	case sdl.K_p:
+		clock.TogglePause()
+	case sdl.K_n: //step a single tick
+		clock.Step()
+	case sdl.K_EQUALS:
+		clock.SpeedUp()
+		fmt.Println("tick speed:", clock.Speed)
+	case sdl.K_MINUS:
+		clock.SlowDown()
+		fmt.Println("tick speed:", clock.Speed)
+	case sdl.K_o: //cycle through the scan orders
+		world.SetScanOrder((world.ScanOrder + 1) % len(scanOrderNames))
+		fmt.Println("scan order:", ScanOrderName(world.ScanOrder))
+	case sdl.K_l: //turn the light around the world
+		light.Turn(LIGHT_TURN_STEP)
+	case sdl.K_m: //switch between the MoveCell and block rules
+		world.SetUpdateMode((world.UpdateMode + 1) % len(updateModeNames))
+		fmt.Println("update mode:", UpdateModeName(world.UpdateMode))
+	case sdl.K_F5:
+		if err := SaveWorldFile(world, SAVE_PATH); err != nil {
+			fmt.Println(err)
+		}
+	case sdl.K_F6: //start or stop recording a replay
+		if recorder != nil {
+			stopRecording()
+			break
+		}
+		var err error
+		if recorder, err = StartRecording(world, REPLAY_PATH); err != nil {
+			fmt.Println(err)
+			break
+		}
+		fmt.Println("recording to", REPLAY_PATH)
+	case sdl.K_F7:
+		if recorder != nil {
+			fmt.Println("stop recording before playing a replay")
+			break
+		}
+		if err := startReplay(REPLAY_PATH); err != nil {
+			fmt.Println(err)
+		}
+	case sdl.K_F9:
+		loaded, err := LoadWorldFile(SAVE_PATH)
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		replaceWorld(loaded)
+	case sdl.K_F8: //start or stop recording frames
+		if frameRecorder != nil {
+			stopFrameRecording()
+		} else {
+			startFrameRecording()
+		}
+	case sdl.K_F12: //the next frame drawn gets saved
+		screenshotRequested = true
+	case sdl.K_g: //generate new terrain
+		settings := terrain.DefaultSettings(time.Now().UnixNano())
+		settings.SeaLevel, settings.Roughness = config.SeaLevel, config.Roughness
+		generated := MakeWorld(world.Width, world.Height, world.Depth)
+		GenerateTerrain(generated, settings)
+		generated.SetSeed(settings.Seed)
+		replaceWorld(generated)
+		fmt.Println("generated terrain with seed", settings.Seed)
+	case sdl.K_LEFT: //scrub back through the rewind buffer
+		if !rewindRecorded() {
+			break
+		}
+		clock.Paused = true
+		if _, err := rewind.Back(world); err != nil {
+			fmt.Println(err)
+		}
+	case sdl.K_RIGHT:
+		if !rewindRecorded() {
+			break
+		}
+		if _, err := rewind.Forward(world); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// rewindRecorded gets whether the rewind buffer is being filled, saying why not when it isn't
+func rewindRecorded() bool {
+	if world.GPU != nil { //see the main loop
+		fmt.Println("rewinding isn't recorded with -gpu")
+		return false
+	}
+	return true
+}
+
+// paintCell places the current draw type at the cell the camera is looking at
+func paintCell() {
+	x, y, z, ok := world.GetCameraCell(camera)
+	if !ok {
+		return
+	}
+	switch drawType {
+	case SOURCE:
+		world.AddSource(x, y, z, sourceType, SOURCE_RATE)
+	default:
+		world.AddCell(x, y, z, drawType)
+	}
+}
 
 func handleMouseMovement(t *sdl.MouseMotionEvent) {
 	mouseX, mouseY := lastMouseX+t.XRel, lastMouseY+t.YRel
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const FRAME_RECORDING_PATTERN = "./recording-%v.gif" //filled in with the time, where F8 records to without -record
+const GIF_MIN_DELAY = 2                              //in hundredths of a second, viewers slow down anything quicker
+const GIF_MAX_BYTES = 256 << 20                      //how much memory a GIF's frames can take before no more are kept
+const GIF_QUEUE_FRAMES = 8                           //frames that can wait to be quantised before Frame waits for them
+
+// FrameRecorder saves every Nth frame it's given, either to a numbered sequence of PNGs or to one animated GIF.
+// A GIF is kept in memory until it's stopped, its frames are quantised to its palette on another goroutine so the
+// frames being drawn don't wait on it.
+type FrameRecorder struct {
+	path      string
+	frames    chan *image.RGBA       //frames waiting to be quantised when recording a GIF, nil for PNGs
+	quantised chan []*image.Paletted //all of the GIF's frames once frames is closed
+	delays    []int                  //how long each of the GIF's frames is shown, in hundredths of a second
+	bytes     int                    //memory the GIF's frames take up so far
+	MaxBytes  int                    //no more GIF frames are kept once they'd take up more than this
+	every     int
+	count     int     //frames given so far
+	saved     int     //frames kept so far
+	last      float32 //when the last kept frame was drawn, in seconds
+	full      bool    //whether the GIF has hit MaxBytes
+}
+
+// isGIFPath gets whether a recording to path should be a GIF rather than PNGs
+func isGIFPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".gif")
+}
+
+// checkFrameRecordingPath checks path is either a GIF or has a number pattern to name each PNG with
+func checkFrameRecordingPath(path string) error {
+	if isGIFPath(path) {
+		return nil
+	}
+	first, second := fmt.Sprintf(path, 0), fmt.Sprintf(path, 1)
+	if first == second || strings.Contains(first, "%!") {
+		return fmt.Errorf("%v needs to end in .gif or have a number pattern for each frame like frames/%%04d.png", path)
+	}
+	return nil
+}
+
+// StartFrameRecording starts recording every Nth frame to path, a .gif or a pattern like frames/%04d.png
+func StartFrameRecording(path string, every int) (*FrameRecorder, error) {
+	if err := checkFrameRecordingPath(path); err != nil {
+		return nil, err
+	}
+	if every < 1 {
+		return nil, fmt.Errorf("can't keep every %v frames, it has to be at least 1", every)
+	}
+	r := &FrameRecorder{path: path, every: every, MaxBytes: GIF_MAX_BYTES}
+	if isGIFPath(path) {
+		r.frames = make(chan *image.RGBA, GIF_QUEUE_FRAMES)
+		r.quantised = make(chan []*image.Paletted, 1)
+		go quantiseFrames(r.frames, r.quantised)
+	}
+	return r, nil
+}
+
+// quantiseFrames dithers each frame to the GIF palette in the order they come, then sends them all to done once
+// frames is closed
+func quantiseFrames(frames <-chan *image.RGBA, done chan<- []*image.Paletted) {
+	var paletted []*image.Paletted
+	for img := range frames {
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(frame, img.Bounds(), img, img.Bounds().Min)
+		paletted = append(paletted, frame)
+	}
+	done <- paletted
+}
+
+// Frame counts a frame drawn at seconds, keeping it if it's an Nth one. read is only called for frames that are kept.
+// Once a GIF is too big to keep any more frames in memory it gets an error and no more are kept, Stop still saves
+// the ones so far.
+func (r *FrameRecorder) Frame(seconds float32, read func() *image.RGBA) error {
+	r.count++
+	if r.full {
+		return r.fullError()
+	}
+	if (r.count-1)%r.every != 0 {
+		return nil
+	}
+	img := read()
+	if r.frames == nil {
+		if err := SavePNG(fmt.Sprintf(r.path, r.saved), img); err != nil {
+			return err
+		}
+	} else if err := r.addGIFFrame(img, seconds); err != nil {
+		return err
+	}
+	r.saved++
+	return nil
+}
+
+// addGIFFrame queues img to be added to the GIF, the previous frame is shown until seconds
+func (r *FrameRecorder) addGIFFrame(img *image.RGBA, seconds float32) error {
+	size := img.Bounds().Dx() * img.Bounds().Dy() //one palette index per pixel
+	if r.bytes+size > r.MaxBytes {
+		r.full = true
+		return r.fullError()
+	}
+	r.bytes += size
+	if n := len(r.delays); n > 0 {
+		//go by the total time so the rounding doesn't build up
+		r.delays[n-1] = max(hundredths(seconds)-hundredths(r.last), GIF_MIN_DELAY)
+	}
+	r.delays = append(r.delays, GIF_MIN_DELAY)
+	r.last = seconds
+	r.frames <- img
+	return nil
+}
+
+// Full gets whether a GIF has run out of room for frames, every Frame after that is an error
+func (r *FrameRecorder) Full() bool {
+	return r.full
+}
+
+func (r *FrameRecorder) fullError() error {
+	return fmt.Errorf("%v has used the %v MB its frames can take, only the first %v can be saved", r.path, r.MaxBytes>>20, r.saved)
+}
+
+func hundredths(seconds float32) int {
+	return int(math.Round(float64(seconds) * 100))
+}
+
+// Stop ends the recording, waiting for the GIF's frames to be quantised and writing it out if it is one, and gets
+// how many frames were kept
+func (r *FrameRecorder) Stop() (int, error) {
+	if r.frames == nil {
+		return r.saved, nil
+	}
+	close(r.frames)
+	recording := &gif.GIF{Image: <-r.quantised, Delay: r.delays}
+	if len(recording.Image) == 0 {
+		return r.saved, nil
+	}
+	if n := len(recording.Delay); n > 1 {
+		recording.Delay[n-1] = recording.Delay[n-2] //nothing comes after the last frame, so show it as long as the one before
+	}
+	file, err := os.Create(r.path)
+	if err != nil {
+		return r.saved, fmt.Errorf("failed to create %v: %v", r.path, err)
+	}
+	if err := gif.EncodeAll(file, recording); err != nil {
+		file.Close()
+		return r.saved, fmt.Errorf("failed to write %v: %v", r.path, err)
+	}
+	if err := file.Close(); err != nil {
+		return r.saved, fmt.Errorf("failed to write %v: %v", r.path, err)
+	}
+	return r.saved, nil
+}
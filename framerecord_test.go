@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFrame makes a small frame filled with a shade that's different for each frame
+func testFrame(shade uint8) func() *image.RGBA {
+	return func() *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+		for i := range img.Pix {
+			img.Pix[i] = shade
+		}
+		opaque(img)
+		return img
+	}
+}
+
+func TestFrameRecorderGIF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.gif")
+	r, err := StartFrameRecording(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//every other frame at 30 a second, so the kept ones are a fifteenth of a second apart
+	for i := 0; i < 7; i++ {
+		if err := r.Frame(float32(i)/30, testFrame(uint8(i*30))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved, err := r.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != 4 {
+		t.Errorf("kept %v frames, want 4", saved)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	recorded, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded.Image) != 4 {
+		t.Fatalf("the gif has %v frames, want 4", len(recorded.Image))
+	}
+	//the rounding is taken from the total time so it adds up to the right length
+	if want := []int{7, 6, 7, 7}; fmt.Sprint(recorded.Delay) != fmt.Sprint(want) {
+		t.Errorf("got delays %v, want %v", recorded.Delay, want)
+	}
+	if bounds := recorded.Image[0].Bounds(); bounds.Dx() != 4 || bounds.Dy() != 3 {
+		t.Errorf("frames are %v", bounds)
+	}
+}
+
+func TestFrameRecorderGIFBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.gif")
+	r, err := StartFrameRecording(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.MaxBytes = 3 * 4 * 3 //room for three of the 4x3 test frames
+	reads := 0
+	for i := 0; i < 5; i++ {
+		read := func() *image.RGBA {
+			reads++
+			return testFrame(uint8(i * 40))()
+		}
+		err := r.Frame(float32(i)/10, read)
+		if full := i >= 3; full != (err != nil) {
+			t.Errorf("frame %v got %v", i, err)
+		}
+	}
+	if !r.Full() {
+		t.Errorf("the recorder doesn't say it's full")
+	}
+	saved, err := r.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != 3 {
+		t.Errorf("kept %v frames, want the 3 that fit", saved)
+	}
+	if reads != 4 {
+		t.Errorf("read %v frames, once the gif is full it shouldn't read any more", reads)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	recorded, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded.Image) != 3 {
+		t.Errorf("the gif has %v frames, want 3", len(recorded.Image))
+	}
+}
+
+func TestFrameRecorderPNGs(t *testing.T) {
+	dir := t.TempDir()
+	r, err := StartFrameRecording(filepath.Join(dir, "frame-%03d.png"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := r.Frame(float32(i), testFrame(uint8(i*100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if saved, err := r.Stop(); err != nil || saved != 3 {
+		t.Fatalf("stopping got %v frames and %v", saved, err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("frame-%03d.png", i))); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFrameRecordingPaths(t *testing.T) {
+	for path, ok := range map[string]bool{
+		"run.gif":            true,
+		"RUN.GIF":            true,
+		"frames/%04d.png":    true,
+		"frame.png":          false,
+		"frame-%s-%d.png":    false,
+		"frames/%d/%04d.png": false,
+	} {
+		if err := checkFrameRecordingPath(path); (err == nil) != ok {
+			t.Errorf("checking %v got %v", path, err)
+		}
+	}
+	//a gif that's stopped without any frames isn't written
+	empty := filepath.Join(t.TempDir(), "empty.gif")
+	r, err := StartFrameRecording(empty, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := r.Stop(); err != nil || saved != 0 {
+		t.Errorf("stopping an empty recording got %v frames and %v", saved, err)
+	}
+	if _, err := os.Stat(empty); err == nil {
+		t.Errorf("an empty recording was written")
+	}
+	if _, err := StartFrameRecording("run.gif", 0); err == nil {
+		t.Errorf("expected an error keeping every 0 frames")
+	}
+}
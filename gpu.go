@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/go-gl/gl/v4.6-core/gl"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+const GPU_GROUP_SIZE = 4            //compute shader work groups are this many blocks or cells along each side
+const CELL_TYPE_MASK = 0xff         //the bits of a packed GPU cell holding its type, the rest hold a source's Emit
+const GPU_DRAW_COMMAND_SIZE = 4 * 4 //one glDrawArraysIndirect command, the opaque cells' comes first then the water's
+const GPU_SORT_GROUP_SIZE = 256     //work group size of the water sorting shaders, which work on a flat list
+
+// gpuSource is a source's state on the GPU, laid out to match Source in sim_sources.comp.
+// Sources never move so they're kept in a list instead of making every cell carry their settings.
+type gpuSource struct {
+	Index  uint32 //the cell the source is in
+	Emit   uint32
+	Rate   float32
+	Charge float32
+}
+
+// GPUSim runs the block rules with compute shaders and draws the world straight from the GPU's copy of the grid.
+// While a world is attached the GPU's grid is the real one, the world's Cells are only brought up to date when
+// something on the CPU needs them, see World.pullGPU.
+type GPUSim struct {
+	blockShader, sourceShader, visibleShader *shader
+	waterKeysShader, waterSortShader         *shader
+	drawShader, shadowShader                 *shader
+
+	cells, sources, instances, waterInstances, waterKeys, command uint32 //buffers
+	width, height, depth                                          int
+	sourceList                                                    []gpuSource
+	sourceIndex                                                   map[int]int //cell index to where the source is in sourceList
+
+	stale bool //whether the GPU has ticked since the world's Cells were last synced
+}
+
+// gpuDefines gives the shaders the cell types and sizes from the Go side so they can't drift apart
+func gpuDefines() string {
+	defines := fmt.Sprintf("#define CELL_TYPE_MASK %vu\n#define GROUP_SIZE %v\n#define SORT_GROUP_SIZE %v\n#define CELL_TYPE_COUNT %v\n",
+		CELL_TYPE_MASK, GPU_GROUP_SIZE, GPU_SORT_GROUP_SIZE, len(cellTypeNames))
+	for cellType, name := range cellTypeNames {
+		defines += fmt.Sprintf("#define %v %vu\n", strings.ToUpper(name), cellType)
+	}
+	return defines
+}
+
+// NewGPUSim compiles the simulation and drawing shaders, a GL 4.3 or newer context has to be current.
+// Cells are drawn with materials, their texture array has to be bound to unit 0.
+func NewGPUSim(assets *AssetLoader, materials *Materials) (*GPUSim, error) {
+	g := &GPUSim{sourceIndex: make(map[int]int)}
+	var err error
+	if g.blockShader, err = LoadComputeShader(assets, "sim_blocks.comp", gpuDefines()); err != nil {
+		return nil, err
+	}
+	if g.sourceShader, err = LoadComputeShader(assets, "sim_sources.comp", gpuDefines()); err != nil {
+		return nil, err
+	}
+	if g.visibleShader, err = LoadComputeShader(assets, "sim_visible.comp", gpuDefines()); err != nil {
+		return nil, err
+	}
+	if g.waterKeysShader, err = LoadComputeShader(assets, "sim_water_keys.comp", gpuDefines()); err != nil {
+		return nil, err
+	}
+	if g.waterSortShader, err = LoadComputeShader(assets, "sim_water_sort.comp", gpuDefines()); err != nil {
+		return nil, err
+	}
+
+	if g.drawShader, err = LoadShaderWithDefines(assets, "gpu_world.vs", "world.fs", gpuDefines(), "gpu world shader"); err != nil {
+		return nil, err
+	}
+	g.drawShader.use()
+	setupDrawShader(g.drawShader, materials)
+	if g.shadowShader, err = LoadShaderWithDefines(assets, "gpu_world.vs", "shadow.fs", gpuDefines(), "gpu shadow shader"); err != nil {
+		return nil, err
+	}
+
+	gl.GenBuffers(1, &g.cells)
+	gl.GenBuffers(1, &g.sources)
+	gl.GenBuffers(1, &g.instances)
+	gl.GenBuffers(1, &g.waterInstances)
+	gl.GenBuffers(1, &g.waterKeys)
+	gl.GenBuffers(1, &g.command)
+	gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, g.command)
+	gl.BufferData(gl.DRAW_INDIRECT_BUFFER, 2*GPU_DRAW_COMMAND_SIZE, nil, gl.DYNAMIC_DRAW)
+	return g, nil
+}
+
+// setupDrawShader sets the draw shader's uniforms that don't change
+func setupDrawShader(s *shader, materials *Materials) {
+	s.SetInt("Textures", 0)
+	materials.ApplyAll(s)
+}
+
+// WatchShaders has w rebuild the drawing shaders when they're edited, the compute shaders aren't watched
+func (g *GPUSim) WatchShaders(w *ShaderWatcher, assets *AssetLoader, materials *Materials) {
+	w.WatchAssets(g.drawShader, assets, "gpu_world.vs", "world.fs", gpuDefines(), "gpu world shader",
+		func(s *shader) { setupDrawShader(s, materials) })
+	w.WatchAssets(g.shadowShader, assets, "gpu_world.vs", "shadow.fs", gpuDefines(), "gpu shadow shader", nil)
+}
+
+// Delete frees everything on the GPU
+func (g *GPUSim) Delete() {
+	for _, s := range []*shader{g.blockShader, g.sourceShader, g.visibleShader, g.waterKeysShader, g.waterSortShader, g.drawShader, g.shadowShader} {
+		gl.DeleteProgram(s.ID)
+	}
+	for _, buffer := range []uint32{g.cells, g.sources, g.instances, g.waterInstances, g.waterKeys, g.command} {
+		gl.DeleteBuffers(1, &buffer)
+	}
+}
+
+// packCell packs a cell into the GPU's format, a source's other settings go in the source list
+func packCell(cell Cell) uint32 {
+	if cell.Type == SOURCE {
+		return uint32(cell.Type) | uint32(cell.Emit)<<8
+	}
+	return uint32(cell.Type)
+}
+
+// unpackCell turns a packed GPU cell back into a cell, source is used for SOURCE cells
+func unpackCell(packed uint32, source gpuSource) Cell {
+	cell := Cell{Type: int(packed & CELL_TYPE_MASK)}
+	if cell.Type == SOURCE {
+		cell.Emit, cell.Rate, cell.Charge = int(packed>>8), source.Rate, source.Charge
+	}
+	return cell
+}
+
+// gpuIndex flattens x,y,z in the same order as the shaders
+func (g *GPUSim) gpuIndex(x, y, z int) int {
+	return (x*g.height+y)*g.depth + z
+}
+
+// Attach uploads w and makes the GPU run its updates from now on
+func (g *GPUSim) Attach(w *World) {
+	w.GPU = g
+	g.Upload(w)
+}
+
+// Upload copies the whole of w's grid to the GPU
+func (g *GPUSim) Upload(w *World) {
+	size := w.Width * w.Height * w.Depth
+	if w.Width != g.width || w.Height != g.height || w.Depth != g.depth {
+		g.width, g.height, g.depth = w.Width, w.Height, w.Depth
+		gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, g.cells)
+		gl.BufferData(gl.SHADER_STORAGE_BUFFER, size*4, nil, gl.DYNAMIC_COPY)
+		//the water lists are sorted in place, which needs room to pad them out to a power of two
+		for buffer, length := range map[uint32]int{g.instances: size, g.waterInstances: nextPowerOfTwo(size), g.waterKeys: nextPowerOfTwo(size)} {
+			gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, buffer)
+			gl.BufferData(gl.SHADER_STORAGE_BUFFER, length*4, nil, gl.DYNAMIC_COPY)
+		}
+	}
+
+	packed := make([]uint32, size)
+	g.sourceList = g.sourceList[:0]
+	clear(g.sourceIndex)
+	for x := range w.Cells {
+		for y := range w.Cells[x] {
+			for z, cell := range w.Cells[x][y] {
+				index := g.gpuIndex(x, y, z)
+				packed[index] = packCell(cell)
+				if cell.Type == SOURCE {
+					g.sourceIndex[index] = len(g.sourceList)
+					g.sourceList = append(g.sourceList, gpuSource{uint32(index), uint32(cell.Emit), cell.Rate, cell.Charge})
+				}
+			}
+		}
+	}
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, g.cells)
+	gl.BufferSubData(gl.SHADER_STORAGE_BUFFER, 0, size*4, gl.Ptr(packed))
+	g.uploadSources()
+	g.stale = false
+}
+
+// uploadSources replaces the GPU's source list with sourceList
+func (g *GPUSim) uploadSources() {
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, g.sources)
+	if len(g.sourceList) == 0 {
+		gl.BufferData(gl.SHADER_STORAGE_BUFFER, int(unsafe.Sizeof(gpuSource{})), nil, gl.DYNAMIC_COPY) //can't bind an empty buffer
+		return
+	}
+	gl.BufferData(gl.SHADER_STORAGE_BUFFER, len(g.sourceList)*int(unsafe.Sizeof(gpuSource{})), gl.Ptr(g.sourceList), gl.DYNAMIC_COPY)
+}
+
+// downloadSources reads the sources' charges back from the GPU
+func (g *GPUSim) downloadSources() {
+	if len(g.sourceList) == 0 {
+		return
+	}
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, g.sources)
+	gl.GetBufferSubData(gl.SHADER_STORAGE_BUFFER, 0, len(g.sourceList)*int(unsafe.Sizeof(gpuSource{})), gl.Ptr(g.sourceList))
+}
+
+// Download copies the GPU's grid back into w's Cells if it's changed since the last sync
+func (g *GPUSim) Download(w *World) {
+	if !g.stale {
+		return
+	}
+	packed := make([]uint32, w.Width*w.Height*w.Depth)
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, g.cells)
+	gl.GetBufferSubData(gl.SHADER_STORAGE_BUFFER, 0, len(packed)*4, gl.Ptr(packed))
+	g.downloadSources()
+
+	for x := range w.Cells {
+		for y := range w.Cells[x] {
+			for z := range w.Cells[x][y] {
+				index := g.gpuIndex(x, y, z)
+				var source gpuSource
+				if packed[index]&CELL_TYPE_MASK == SOURCE {
+					source = g.sourceList[g.sourceIndex[index]]
+				}
+				w.Cells[x][y][z] = unpackCell(packed[index], source)
+			}
+		}
+	}
+	g.stale = false
+}
+
+// downloadCell copies just the cell at x,y,z back into w's Cells
+func (g *GPUSim) downloadCell(w *World, x, y, z int) {
+	if !g.stale {
+		return
+	}
+	index := g.gpuIndex(x, y, z)
+	var packed uint32
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, g.cells)
+	gl.GetBufferSubData(gl.SHADER_STORAGE_BUFFER, index*4, 4, gl.Ptr(&packed))
+
+	var source gpuSource
+	if i, ok := g.sourceIndex[index]; ok {
+		g.downloadSources()
+		source = g.sourceList[i]
+	}
+	w.Cells[x][y][z] = unpackCell(packed, source)
+}
+
+// uploadCell copies just the cell at x,y,z from w's Cells to the GPU
+func (g *GPUSim) uploadCell(w *World, x, y, z int) {
+	index := g.gpuIndex(x, y, z)
+	cell := w.Cells[x][y][z]
+	packed := packCell(cell)
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, g.cells)
+	gl.BufferSubData(gl.SHADER_STORAGE_BUFFER, index*4, 4, gl.Ptr(&packed))
+
+	i, wasSource := g.sourceIndex[index]
+	if !wasSource && cell.Type != SOURCE {
+		return
+	}
+	g.downloadSources() //the other sources' charges have moved on since they were last uploaded
+	switch {
+	case cell.Type == SOURCE && wasSource:
+		g.sourceList[i] = gpuSource{uint32(index), uint32(cell.Emit), cell.Rate, cell.Charge}
+	case cell.Type == SOURCE:
+		g.sourceIndex[index] = len(g.sourceList)
+		g.sourceList = append(g.sourceList, gpuSource{uint32(index), uint32(cell.Emit), cell.Rate, cell.Charge})
+	default: //move the last source into the removed one's place
+		last := g.sourceList[len(g.sourceList)-1]
+		g.sourceList[i] = last
+		g.sourceIndex[int(last.Index)] = i
+		g.sourceList = g.sourceList[:len(g.sourceList)-1]
+		delete(g.sourceIndex, index)
+	}
+	g.uploadSources()
+}
+
+// groups gets how many work groups it takes to cover n things
+func (g *GPUSim) groups(n int) uint32 {
+	return uint32((n + GPU_GROUP_SIZE - 1) / GPU_GROUP_SIZE)
+}
+
+// Step runs one tick of the block rules on the GPU, the same as World.updateBlocks does on the CPU
+func (g *GPUSim) Step(w *World) {
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 0, g.cells)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 1, g.sources)
+
+	if len(g.sourceList) > 0 {
+		g.sourceShader.use()
+		g.sourceShader.SetIVec3("Size", int32(g.width), int32(g.height), int32(g.depth))
+		g.sourceShader.SetInt("SourceCount", int32(len(g.sourceList)))
+		groupSize := GPU_GROUP_SIZE * GPU_GROUP_SIZE * GPU_GROUP_SIZE
+		gl.DispatchCompute(uint32((len(g.sourceList)+groupSize-1)/groupSize), 1, 1)
+		gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+	}
+
+	offset := w.Tick % 2
+	g.blockShader.use()
+	g.blockShader.SetIVec3("Size", int32(g.width), int32(g.height), int32(g.depth))
+	g.blockShader.SetInt("Offset", int32(offset))
+	g.blockShader.SetUint("Seed", blockSeed(w.Seed))
+	g.blockShader.SetInt("Tick", int32(w.Tick))
+	//a block for every pair of cells, plus one more at the start when the grid is shifted back
+	gl.DispatchCompute(g.groups((g.width+offset+1)/2), g.groups((g.height+offset+1)/2), g.groups((g.depth+offset+1)/2))
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+	g.stale = true
+}
+
+// CollectVisible picks out the cells that aren't buried by other cells from the GPU's grid as it is right now,
+// it has to be called each frame before anything is drawn
+func (g *GPUSim) CollectVisible() {
+	//36 vertices for the cube, the instance counts are filled in by sim_visible.comp
+	commands := [8]uint32{36, 0, 0, 0, 36, 0, 0, 0}
+	gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, g.command)
+	gl.BufferSubData(gl.DRAW_INDIRECT_BUFFER, 0, 2*GPU_DRAW_COMMAND_SIZE, gl.Ptr(&commands[0]))
+
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 0, g.cells)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 2, g.instances)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 3, g.command)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 4, g.waterInstances)
+	g.visibleShader.use()
+	g.visibleShader.SetIVec3("Size", int32(g.width), int32(g.height), int32(g.depth))
+	gl.DispatchCompute(g.groups(g.width), g.groups(g.height), g.groups(g.depth))
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT | gl.COMMAND_BARRIER_BIT)
+}
+
+// Draw draws the solid cells picked out by CollectVisible.
+// setup is called with the drawing shader in use to set the camera and lighting uniforms.
+func (g *GPUSim) Draw(setup func(s *shader), cellSize float32, vao uint32) {
+	g.drawInstances(g.drawShader, setup, cellSize, vao, g.instances, 0)
+}
+
+// DrawShadows draws the solid cells picked out by CollectVisible into the shadow map being rendered,
+// setup sets the light's projection and view
+func (g *GPUSim) DrawShadows(setup func(s *shader), cellSize float32, vao uint32) {
+	g.drawInstances(g.shadowShader, setup, cellSize, vao, g.instances, 0)
+}
+
+// SortWater orders the water cells picked out by CollectVisible from furthest to nearest viewPos, so DrawWater
+// blends them back to front. It reads back how many there are to size the sort, which waits for CollectVisible.
+func (g *GPUSim) SortWater(viewPos glm.Vec3, cellSize float32) {
+	var count uint32
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, g.command)
+	gl.GetBufferSubData(gl.DRAW_INDIRECT_BUFFER, GPU_DRAW_COMMAND_SIZE+4, 4, gl.Ptr(&count)) //the water's instance count
+	if count < 2 {
+		return
+	}
+	padded := nextPowerOfTwo(int(count))
+	groups := uint32((padded + GPU_SORT_GROUP_SIZE - 1) / GPU_SORT_GROUP_SIZE)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 4, g.waterInstances)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 5, g.waterKeys)
+
+	g.waterKeysShader.use()
+	g.waterKeysShader.SetIVec3("Size", int32(g.width), int32(g.height), int32(g.depth))
+	g.waterKeysShader.SetFloat("CellSize", cellSize)
+	g.waterKeysShader.SetVec3("ViewPos", &viewPos)
+	g.waterKeysShader.SetUint("Count", count)
+	g.waterKeysShader.SetUint("Padded", uint32(padded))
+	gl.DispatchCompute(groups, 1, 1)
+	gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+
+	g.waterSortShader.use()
+	g.waterSortShader.SetUint("Padded", uint32(padded))
+	for stage := 2; stage <= padded; stage *= 2 {
+		g.waterSortShader.SetUint("Stage", uint32(stage))
+		for step := stage / 2; step > 0; step /= 2 {
+			g.waterSortShader.SetUint("Step", uint32(step))
+			gl.DispatchCompute(groups, 1, 1)
+			gl.MemoryBarrier(gl.SHADER_STORAGE_BARRIER_BIT)
+		}
+	}
+}
+
+// nextPowerOfTwo rounds n up to a power of two
+func nextPowerOfTwo(n int) int {
+	power := 1
+	for power < n {
+		power *= 2
+	}
+	return power
+}
+
+// DrawWater draws the water cells picked out by CollectVisible, in the order SortWater left them, with
+// gpu_world.vs dropping the faces that don't open onto air. The caller sets up blending.
+func (g *GPUSim) DrawWater(setup func(s *shader), cellSize float32, vao uint32) {
+	g.drawInstances(g.drawShader, setup, cellSize, vao, g.waterInstances, GPU_DRAW_COMMAND_SIZE)
+}
+
+// drawInstances draws the cells in the instance buffer with s and the indirect command at offset in the command
+// buffer
+func (g *GPUSim) drawInstances(s *shader, setup func(s *shader), cellSize float32, vao, instances uint32, offset int) {
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 0, g.cells)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 2, instances)
+	gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, g.command)
+	s.use()
+	setup(s)
+	s.SetIVec3("Size", int32(g.width), int32(g.height), int32(g.depth))
+	s.SetFloat("CellSize", cellSize)
+	gl.BindVertexArray(vao)
+	gl.DrawArraysIndirect(gl.TRIANGLES, gl.PtrOffset(offset))
+}
+
+// ------------------------------ Keeping the World in sync ------------------------------
+
+// pullGPU brings the world's Cells up to date with the GPU, if it's running the world
+func (w *World) pullGPU() {
+	if w.GPU != nil {
+		w.GPU.Download(w)
+	}
+}
+
+// pullGPUCell brings just the cell at x,y,z up to date with the GPU
+func (w *World) pullGPUCell(x, y, z int) {
+	if w.GPU != nil {
+		w.GPU.downloadCell(w, x, y, z)
+	}
+}
+
+// pushGPUCell copies just the cell at x,y,z to the GPU
+func (w *World) pushGPUCell(x, y, z int) {
+	if w.GPU != nil {
+		w.GPU.uploadCell(w, x, y, z)
+	}
+}
+
+// pushGPU copies the world's Cells to the GPU, if it's running the world
+func (w *World) pushGPU() {
+	if w.GPU != nil {
+		w.GPU.Upload(w)
+	}
+}
@@ -0,0 +1,145 @@
+//go:build gpu
+
+package main
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/go-gl/gl/v4.6-core/gl"
+	glm "github.com/go-gl/mathgl/mgl32"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// glTestContext makes a hidden window with a major.minor core context current for the rest of the test, skipping
+// it if there's no display or the driver can't make one. LIBGL_ALWAYS_SOFTWARE=1 runs these on Mesa's llvmpipe.
+func glTestContext(t *testing.T, major, minor int) {
+	runtime.LockOSThread()
+	t.Cleanup(runtime.UnlockOSThread)
+	if err := sdl.Init(sdl.INIT_VIDEO); err != nil {
+		t.Skipf("no video: %v", err)
+	}
+	t.Cleanup(sdl.Quit)
+	if err := requestCoreContext(major, minor); err != nil {
+		t.Fatal(err)
+	}
+	window, err := sdl.CreateWindow("gl test", 0, 0, 64, 64, sdl.WINDOW_OPENGL|sdl.WINDOW_HIDDEN)
+	if err != nil {
+		t.Skipf("no window: %v", err)
+	}
+	t.Cleanup(func() { window.Destroy() })
+	context, err := window.GLCreateContext()
+	if err != nil {
+		t.Skipf("no GL %v.%v context: %v", major, minor, err)
+	}
+	t.Cleanup(func() { sdl.GLDeleteContext(context) })
+	if err := gl.Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGPUMatchesCPU runs the same world with the block rules on the CPU and on the GPU and checks they stay identical.
+// It needs a GL 4.3 context so it only builds with go test -tags gpu.
+func TestGPUMatchesCPU(t *testing.T) {
+	glTestContext(t, 4, 3)
+
+	assets := NewAssetLoader("")
+	materials, err := LoadMaterials(assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGPUSim(assets, materials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Delete()
+
+	makeScene := func() *World {
+		w := MakeWorld(24, 20, 24)
+		w.SetSeed(11)
+		w.UpdateMode = UPDATE_BLOCK
+		w.FillBox(0, 0, 0, 23, 0, 23, WALL)
+		w.FillSphere(7, 12, 7, 5, DIRT)
+		w.FillSphere(16, 12, 16, 5, WATER)
+		w.AddSource(12, 19, 12, WATER, 0.5)
+		w.AddSource(4, 19, 18, DIRT, 0.3)
+		w.AddCell(18, 1, 5, SINK)
+		return w
+	}
+	cpu, gpu := makeScene(), makeScene()
+	g.Attach(gpu)
+
+	for i := 0; i < 200; i++ {
+		cpu.Update()
+		gpu.Update()
+		if i%10 == 9 && cpu.HashCells() != gpu.HashCells() {
+			t.Fatalf("the GPU diverged from the CPU by tick %v", gpu.Tick)
+		}
+	}
+
+	//edits made while the GPU is running have to reach it
+	cpu.AddCell(12, 18, 12, DIRT)
+	gpu.AddCell(12, 18, 12, DIRT)
+	cpu.AddSource(20, 19, 3, DIRT, 1)
+	gpu.AddSource(20, 19, 3, DIRT, 1)
+	for i := 0; i < 50; i++ {
+		cpu.Update()
+		gpu.Update()
+	}
+	if cpu.HashCells() != gpu.HashCells() {
+		t.Errorf("the GPU diverged from the CPU after editing")
+	}
+}
+
+// TestGPUWaterSort checks SortWater leaves every visible water cell in the list, furthest from the camera first
+func TestGPUWaterSort(t *testing.T) {
+	glTestContext(t, 4, 3)
+	assets := NewAssetLoader("")
+	materials, err := LoadMaterials(assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGPUSim(assets, materials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Delete()
+
+	w := MakeWorld(20, 12, 20)
+	w.FillBox(2, 0, 2, 17, 3, 17, WATER)
+	w.FillSphere(6, 8, 14, 3, WATER)
+	for i := 0; i < 10; i++ {
+		w.AddCell(i*2, 11, 19-i, WATER)
+	}
+	g.Attach(w)
+	g.CollectVisible()
+	viewPos := glm.Vec3{0.3, 0.8, -0.9}
+	g.SortWater(viewPos, w.CellSize())
+
+	var count uint32
+	gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, g.command)
+	gl.GetBufferSubData(gl.DRAW_INDIRECT_BUFFER, GPU_DRAW_COMMAND_SIZE+4, 4, gl.Ptr(&count))
+	if count < 100 {
+		t.Fatalf("only %v water cells were picked out", count)
+	}
+	instances := make([]uint32, count)
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, g.waterInstances)
+	gl.GetBufferSubData(gl.SHADER_STORAGE_BUFFER, 0, len(instances)*4, gl.Ptr(&instances[0]))
+
+	seen := make(map[uint32]bool)
+	last := float32(math.MaxFloat32)
+	for i, index := range instances {
+		x, y, z := int(index)/(w.Height*w.Depth), int(index)/w.Depth%w.Height, int(index)%w.Depth
+		if seen[index] || w.Cells[x][y][z].Type != WATER {
+			t.Fatalf("instance %v is %v,%v,%v which is a duplicate or isn't water", i, x, y, z)
+		}
+		seen[index] = true
+		distance := w.CellPosition(x, y, z).Sub(viewPos).Len()
+		if distance > last+1e-4 {
+			t.Fatalf("instance %v at %v,%v,%v is %v away, further than the one before at %v", i, x, y, z, distance, last)
+		}
+		last = distance
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestPackCell(t *testing.T) {
+	source := Cell{Type: SOURCE, Emit: WATER, Rate: 0.25, Charge: 0.5}
+	packed := packCell(source)
+	if got := unpackCell(packed, gpuSource{Emit: WATER, Rate: 0.25, Charge: 0.5}); got != source {
+		t.Errorf("source came back as %+v", got)
+	}
+	for cellType := range cellTypeNames {
+		if cellType == SOURCE {
+			continue
+		}
+		if got := unpackCell(packCell(Cell{Type: cellType}), gpuSource{}); got.Type != cellType {
+			t.Errorf("%v came back as %v", CellTypeName(cellType), CellTypeName(got.Type))
+		}
+	}
+}
+
+func TestInjectDefines(t *testing.T) {
+	got := string(injectDefines([]byte("#version 460 core\nvoid main() {}\n"), "#define AIR 0u\n"))
+	if want := "#version 460 core\n#define AIR 0u\nvoid main() {}\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNextPowerOfTwo(t *testing.T) {
+	for n, want := range map[int]int{0: 1, 1: 1, 2: 2, 3: 4, 255: 256, 256: 256, 257: 512, 60 * 60 * 60: 262144} {
+		if got := nextPowerOfTwo(n); got != want {
+			t.Errorf("nextPowerOfTwo(%v) = %v, want %v", n, got, want)
+		}
+	}
+}
@@ -1,18 +1,31 @@
 package main
 
-import "github.com/go-gl/gl/v4.6-core/gl"
+import (
+	"unsafe"
+
+	"github.com/go-gl/gl/v4.6-core/gl"
+)
+
+const VERTEX_STRIDE = 8 //floats per vertex, position then texture coord then normal
 
 type GraphicsResources struct {
 	VAO uint32
 	VBO uint32
 	EBO uint32
 	Vertices []float32
+	Stride int //floats per vertex, VERTEX_STRIDE or WATER_VERTEX_STRIDE for the water mesh
 }
 
 // CreateResources creates a GraphicsResources struct instance to hold important stuff
 func CreateResources(vertices []float32) *GraphicsResources {
+	return CreateResourcesWithStride(vertices, VERTEX_STRIDE)
+}
+
+// CreateResourcesWithStride is CreateResources for vertices with extra data after the normal
+func CreateResourcesWithStride(vertices []float32, stride int) *GraphicsResources {
 	n := new(GraphicsResources)
 	n.Vertices = vertices
+	n.Stride = stride
 	n.MakeObjects()
 	
 	return n
@@ -26,13 +39,43 @@ func (g *GraphicsResources) MakeObjects()  {
 	gl.BindVertexArray(g.VAO)
 
 	gl.BindBuffer(gl.ARRAY_BUFFER, g.VBO)
-	gl.BufferData(gl.ARRAY_BUFFER, len(g.Vertices)*4, gl.Ptr(g.Vertices), gl.STATIC_DRAW)
+	gl.BufferData(gl.ARRAY_BUFFER, len(g.Vertices)*4, vertexData(g.Vertices), gl.STATIC_DRAW)
 
 	//position stuff
-	gl.VertexAttribPointerWithOffset(0, 3, gl.FLOAT, false, 5*4, 0)
+	gl.VertexAttribPointerWithOffset(0, 3, gl.FLOAT, false, int32(g.Stride*4), 0)
 	gl.EnableVertexAttribArray(0)
 
 	//texture coord stuff
-	gl.VertexAttribPointerWithOffset(1, 2, gl.FLOAT, false, 5*4, 3*4)
+	gl.VertexAttribPointerWithOffset(1, 2, gl.FLOAT, false, int32(g.Stride*4), 3*4)
 	gl.EnableVertexAttribArray(1)
+
+	//normal stuff
+	gl.VertexAttribPointerWithOffset(2, 3, gl.FLOAT, false, int32(g.Stride*4), 5*4)
+	gl.EnableVertexAttribArray(2)
+
+	//water depth and surface stuff
+	if g.Stride == WATER_VERTEX_STRIDE {
+		gl.VertexAttribPointerWithOffset(3, 2, gl.FLOAT, false, int32(g.Stride*4), VERTEX_STRIDE*4)
+		gl.EnableVertexAttribArray(3)
+	}
+}
+
+// Update replaces the vertices, for meshes like the water that are rebuilt every frame
+func (g *GraphicsResources) Update(vertices []float32) {
+	g.Vertices = vertices
+	gl.BindBuffer(gl.ARRAY_BUFFER, g.VBO)
+	gl.BufferData(gl.ARRAY_BUFFER, len(vertices)*4, vertexData(vertices), gl.DYNAMIC_DRAW)
+}
+
+// VertexCount gets how many vertices there are to draw
+func (g *GraphicsResources) VertexCount() int32 {
+	return int32(len(g.Vertices) / g.Stride)
+}
+
+// vertexData points at vertices for BufferData, gl.Ptr can't take an empty slice
+func vertexData(vertices []float32) unsafe.Pointer {
+	if len(vertices) == 0 {
+		return nil
+	}
+	return gl.Ptr(vertices)
 }
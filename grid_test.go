@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Test grids are text, a header then every layer from the top down.
+// Each layer is a "y N" line followed by one row per z, with one character per x:
+//
+//	size 3 2 3
+//	seed 1
+//	ticks 10
+//	y 1
+//	.d.
+//	...
+//	...
+//	y 0
+//	###
+//	###
+//	###
+//
+// seed, ticks and mode are only needed for inputs, lines starting with // are comments.
+// mode picks the update mode by name and defaults to move.
+
+var gridChars = map[byte]Cell{
+	'.': {Type: AIR},
+	'd': {Type: DIRT},
+	'#': {Type: WALL},
+	'~': {Type: WATER},
+	'x': {Type: SINK},
+	'D': {Type: SOURCE, Emit: DIRT, Rate: 1},
+	'W': {Type: SOURCE, Emit: WATER, Rate: 1},
+}
+
+// gridChar gets the character a cell is written as
+func gridChar(cell Cell) byte {
+	if cell.Type == SOURCE {
+		if cell.Emit == WATER {
+			return 'W'
+		}
+		return 'D'
+	}
+	for char, gridCell := range gridChars {
+		if gridCell.Type == cell.Type && gridCell.Type != SOURCE {
+			return char
+		}
+	}
+	return '?'
+}
+
+// parseGrid parses a test grid into a world, along with how many ticks to run it for
+func parseGrid(text string) (w *World, ticks int, err error) {
+	var seed int64 = 1
+	mode := UPDATE_MOVE
+	layer := -1
+	row := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		fail := func(format string, args ...any) (*World, int, error) {
+			return nil, 0, fmt.Errorf("line %v: %v", lineNum, fmt.Sprintf(format, args...))
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "size":
+			var dims [3]int
+			for i := range dims {
+				if len(fields) != 4 {
+					return fail("size needs 3 numbers")
+				}
+				if dims[i], err = strconv.Atoi(fields[i+1]); err != nil {
+					return fail("bad size %q", fields[i+1])
+				}
+			}
+			w = MakeWorld(dims[0], dims[1], dims[2])
+			continue
+		case "seed":
+			if seed, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+				return fail("bad seed %q", fields[1])
+			}
+			continue
+		case "ticks":
+			if ticks, err = strconv.Atoi(fields[1]); err != nil {
+				return fail("bad ticks %q", fields[1])
+			}
+			continue
+		case "mode":
+			if mode, err = ParseUpdateMode(fields[1]); err != nil {
+				return fail("%v", err)
+			}
+			continue
+		case "y":
+			if w == nil {
+				return fail("size has to come first")
+			}
+			if layer, err = strconv.Atoi(fields[1]); err != nil || layer < 0 || layer >= w.Height {
+				return fail("bad layer %q", fields[1])
+			}
+			row = 0
+			continue
+		}
+
+		if layer < 0 {
+			return fail("rows have to come after a y line")
+		}
+		if row >= w.Depth || len(line) != w.Width {
+			return fail("row doesn't fit a %vx%vx%v world", w.Width, w.Height, w.Depth)
+		}
+		for x := 0; x < w.Width; x++ {
+			cell, ok := gridChars[line[x]]
+			if !ok {
+				return fail("unknown cell %q", line[x])
+			}
+			w.Cells[x][layer][row] = cell
+		}
+		row++
+	}
+	if w == nil {
+		return nil, 0, fmt.Errorf("grid has no size")
+	}
+	w.SetSeed(seed)
+	w.UpdateMode = mode
+	return w, ticks, nil
+}
+
+// formatGrid writes the world as a test grid
+func formatGrid(w *World) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "size %v %v %v\n", w.Width, w.Height, w.Depth)
+	for y := w.Height - 1; y >= 0; y-- {
+		fmt.Fprintf(&b, "y %v\n", y)
+		for z := 0; z < w.Depth; z++ {
+			for x := 0; x < w.Width; x++ {
+				b.WriteByte(gridChar(w.Cells[x][y][z]))
+			}
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
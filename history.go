@@ -0,0 +1,134 @@
+package main
+
+import "unsafe"
+
+const HISTORY_BUDGET = 64 << 20 //default amount of bytes the edit history can use
+
+// cellEdit is a change to a single cell
+type cellEdit struct {
+	X, Y, Z       int
+	Before, After Cell
+}
+
+// editCommand is a group of cell edits that get undone together, like a brush stroke
+type editCommand struct {
+	Edits   []cellEdit
+	indices map[[3]int]int //where each cell is in Edits so repeated edits to a cell only keep the first Before
+}
+
+// size is roughly how many bytes the command takes up
+func (e *editCommand) size() int {
+	return len(e.Edits) * int(unsafe.Sizeof(cellEdit{}))
+}
+
+// EditHistory holds the undo and redo stacks for a world
+type EditHistory struct {
+	MaxBytes  int //once the history goes over this the oldest commands get dropped
+	usedBytes int
+	undo      []*editCommand
+	redo      []*editCommand
+	current   *editCommand //the command being built between BeginEdit and EndEdit
+}
+
+// BeginEdit starts grouping edits into one command until EndEdit is called
+func (w *World) BeginEdit() {
+	w.EndEdit()
+	w.History.current = &editCommand{indices: make(map[[3]int]int)}
+}
+
+// EndEdit finishes the current command and pushes it onto the undo stack
+func (w *World) EndEdit() {
+	h := &w.History
+	if h.current == nil {
+		return
+	}
+	command := h.current
+	h.current = nil
+	if len(command.Edits) == 0 {
+		return
+	}
+
+	command.indices = nil
+	h.undo = append(h.undo, command)
+	h.usedBytes += command.size()
+	for _, redone := range h.redo {
+		h.usedBytes -= redone.size()
+	}
+	h.redo = nil
+
+	for h.usedBytes > h.MaxBytes && len(h.undo) > 0 {
+		h.usedBytes -= h.undo[0].size()
+		h.undo[0] = nil
+		h.undo = h.undo[1:]
+	}
+}
+
+// setCell sets the cell at x,y,z and records the change in the history
+func (w *World) setCell(x, y, z int, cell Cell) {
+	h := &w.History
+	standalone := h.current == nil
+	if standalone {
+		w.BeginEdit()
+	}
+
+	w.pullGPUCell(x, y, z)
+	key := [3]int{x, y, z}
+	if i, ok := h.current.indices[key]; ok {
+		h.current.Edits[i].After = cell
+	} else {
+		h.current.indices[key] = len(h.current.Edits)
+		h.current.Edits = append(h.current.Edits, cellEdit{X: x, Y: y, Z: z, Before: w.Cells[x][y][z], After: cell})
+	}
+	w.Cells[x][y][z] = cell
+	w.pushGPUCell(x, y, z)
+	if w.Recorder != nil {
+		w.Recorder.RecordCell(w.Tick, x, y, z, cell)
+	}
+
+	if standalone {
+		w.EndEdit()
+	}
+}
+
+// Undo reverts the last edit command, returns false if there was nothing to undo
+func (w *World) Undo() bool {
+	w.EndEdit()
+	h := &w.History
+	if len(h.undo) == 0 {
+		return false
+	}
+	command := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+
+	for i := len(command.Edits) - 1; i >= 0; i-- {
+		edit := command.Edits[i]
+		w.Cells[edit.X][edit.Y][edit.Z] = edit.Before
+		w.pushGPUCell(edit.X, edit.Y, edit.Z)
+		if w.Recorder != nil {
+			w.Recorder.RecordCell(w.Tick, edit.X, edit.Y, edit.Z, edit.Before)
+		}
+	}
+	h.redo = append(h.redo, command)
+	return true
+}
+
+// Redo reapplies the last undone edit command, returns false if there was nothing to redo
+func (w *World) Redo() bool {
+	w.EndEdit()
+	h := &w.History
+	if len(h.redo) == 0 {
+		return false
+	}
+	command := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+
+	for _, edit := range command.Edits {
+		w.Cells[edit.X][edit.Y][edit.Z] = edit.After
+		w.pushGPUCell(edit.X, edit.Y, edit.Z)
+		if w.Recorder != nil {
+			w.Recorder.RecordCell(w.Tick, edit.X, edit.Y, edit.Z, edit.After)
+		}
+	}
+	h.undo = append(h.undo, command)
+	return true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestUndoRedoRoundTrip(t *testing.T) {
+	w := MakeWorld(4, 4, 4)
+	w.AddCell(1, 1, 1, WALL)
+	//repeated edits to a cell in one command undo back to how it was before the first
+	w.BeginEdit()
+	w.AddCell(1, 1, 1, DIRT)
+	w.AddCell(1, 1, 1, WATER)
+	w.AddCell(2, 2, 2, DIRT)
+	w.EndEdit()
+
+	if !w.Undo() {
+		t.Fatal("nothing to undo")
+	}
+	if got := w.Cells[1][1][1].Type; got != WALL {
+		t.Errorf("after undo 1,1,1 is %v, want wall", CellTypeName(got))
+	}
+	if got := w.Cells[2][2][2].Type; got != AIR {
+		t.Errorf("after undo 2,2,2 is %v, want air", CellTypeName(got))
+	}
+
+	if !w.Redo() {
+		t.Fatal("nothing to redo")
+	}
+	if got := w.Cells[1][1][1].Type; got != WATER {
+		t.Errorf("after redo 1,1,1 is %v, want water", CellTypeName(got))
+	}
+	if got := w.Cells[2][2][2].Type; got != DIRT {
+		t.Errorf("after redo 2,2,2 is %v, want dirt", CellTypeName(got))
+	}
+
+	//back through both commands to an empty world, then nothing is left
+	w.Undo()
+	w.Undo()
+	if w.CountCells(AIR) != 4*4*4 {
+		t.Errorf("undoing everything left %v cells that aren't air", 4*4*4-w.CountCells(AIR))
+	}
+	if w.Undo() {
+		t.Errorf("undo with an empty history did something")
+	}
+}
+
+func TestNewEditClearsRedo(t *testing.T) {
+	w := MakeWorld(4, 4, 4)
+	w.AddCell(0, 0, 0, DIRT)
+	w.AddCell(1, 0, 0, DIRT)
+	w.Undo()
+	w.AddCell(2, 0, 0, WALL)
+	if w.Redo() {
+		t.Errorf("redo still worked after a new edit")
+	}
+	if got := w.Cells[1][0][0].Type; got != AIR {
+		t.Errorf("the undone cell came back as %v", CellTypeName(got))
+	}
+	if w.History.usedBytes != 2*int(unsafe.Sizeof(cellEdit{})) {
+		t.Errorf("the history thinks it uses %v bytes with two single cell edits", w.History.usedBytes)
+	}
+}
+
+func TestHistoryBudgetDropsOldest(t *testing.T) {
+	w := MakeWorld(8, 1, 1)
+	editSize := int(unsafe.Sizeof(cellEdit{}))
+	w.History.MaxBytes = 3 * editSize
+	for x := 0; x < 5; x++ {
+		w.AddCell(x, 0, 0, DIRT)
+	}
+	if len(w.History.undo) != 3 || w.History.usedBytes != 3*editSize {
+		t.Fatalf("the history kept %v commands using %v bytes, want 3 using %v", len(w.History.undo), w.History.usedBytes, 3*editSize)
+	}
+	for w.Undo() {
+	}
+	//only the three newest edits could be undone
+	for x, want := range []int{DIRT, DIRT, AIR, AIR, AIR} {
+		if got := w.Cells[x][0][0].Type; got != want {
+			t.Errorf("cell %v is %v after undoing everything, want %v", x, CellTypeName(got), CellTypeName(want))
+		}
+	}
+
+	//a single command bigger than the whole budget can't be kept at all
+	w.FillBox(0, 0, 0, 7, 0, 0, WALL)
+	if len(w.History.undo) != 0 || w.History.usedBytes != 0 {
+		t.Errorf("an edit over the budget was kept: %v commands using %v bytes", len(w.History.undo), w.History.usedBytes)
+	}
+}
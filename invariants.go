@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// InvariantChecker watches a world's updates for bugs that would otherwise show up as material slowly vanishing or multiplying.
+// Each tick it checks the amount of every cell type only changed by what sources spawned and sinks drained,
+// and that no cell moved more than once. Anything new that creates, destroys or converts cells has to report it here.
+type InvariantChecker struct {
+	before     []int  //how many of each type there were at the start of the tick
+	spawned    []int  //how many of each type sources made this tick
+	drained    []int  //how many of each type sinks removed this tick
+	movedTo    []bool //which cells had something move into them this tick, indexed by cellIndex
+	tick       int
+	violations []error
+}
+
+// EnableInvariantChecks turns on invariant checking for the world's updates
+func (w *World) EnableInvariantChecks() {
+	w.Checker = new(InvariantChecker)
+}
+
+// Err returns everything that went wrong since the last call, or nil if nothing did
+func (c *InvariantChecker) Err() error {
+	err := errors.Join(c.violations...)
+	c.violations = nil
+	return err
+}
+
+// countCells counts how many of each cell type there are
+func (c *InvariantChecker) countCells(w *World) []int {
+	counts := make([]int, len(cellTypeNames))
+	for x := range w.Cells {
+		for y := range w.Cells[x] {
+			for z := range w.Cells[x][y] {
+				if cellType := w.Cells[x][y][z].Type; cellType >= 0 && cellType < len(counts) {
+					counts[cellType]++
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// cellIndex flattens x,y,z into an index
+func (c *InvariantChecker) cellIndex(w *World, x, y, z int) int {
+	return (x*w.Height+y)*w.Depth + z
+}
+
+// beginTick records the state at the start of an update
+func (c *InvariantChecker) beginTick(w *World) {
+	c.tick = w.Tick
+	c.before = c.countCells(w)
+	c.spawned = make([]int, len(cellTypeNames))
+	c.drained = make([]int, len(cellTypeNames))
+	if len(c.movedTo) != w.Width*w.Height*w.Depth {
+		c.movedTo = make([]bool, w.Width*w.Height*w.Depth)
+	} else {
+		clear(c.movedTo)
+	}
+}
+
+// endTick checks the counts at the end of an update add up
+func (c *InvariantChecker) endTick(w *World) {
+	after := c.countCells(w)
+	for cellType := range after {
+		expected := c.before[cellType] + c.spawned[cellType] - c.drained[cellType]
+		if after[cellType] != expected && cellType != AIR {
+			c.violate("%v count went from %v to %v but sources and sinks only account for %v",
+				CellTypeName(cellType), c.before[cellType], after[cellType], expected)
+		}
+	}
+}
+
+// spawn records a source making a cell
+func (c *InvariantChecker) spawn(cellType int) {
+	if cellType >= 0 && cellType < len(c.spawned) {
+		c.spawned[cellType]++
+	}
+}
+
+// drain records a sink removing the cell at x,y,z
+func (c *InvariantChecker) drain(w *World, x, y, z int) {
+	if c.movedTo == nil { //not inside an update
+		return
+	}
+	from := c.cellIndex(w, x, y, z)
+	cellType := w.Cells[x][y][z].Type
+	if c.movedTo[from] {
+		c.violate("%v at %v,%v,%v moved twice", CellTypeName(cellType), x, y, z)
+	}
+	c.movedTo[from] = false
+	if cellType >= 0 && cellType < len(c.drained) {
+		c.drained[cellType]++
+	}
+}
+
+// swap records the cells at x1,y1,z1 and x2,y2,z2 swapping, complaining if either already moved this tick
+func (c *InvariantChecker) swap(w *World, x1, y1, z1, x2, y2, z2 int) {
+	if c.movedTo == nil {
+		return
+	}
+	first, second := c.cellIndex(w, x1, y1, z1), c.cellIndex(w, x2, y2, z2)
+	firstType, secondType := w.Cells[x1][y1][z1].Type, w.Cells[x2][y2][z2].Type
+	if firstType != AIR && c.movedTo[first] {
+		c.violate("%v at %v,%v,%v moved twice", CellTypeName(firstType), x1, y1, z1)
+	}
+	if secondType != AIR && c.movedTo[second] {
+		c.violate("%v at %v,%v,%v moved twice", CellTypeName(secondType), x2, y2, z2)
+	}
+	c.movedTo[first], c.movedTo[second] = secondType != AIR, firstType != AIR
+}
+
+// violate records something going wrong
+func (c *InvariantChecker) violate(format string, args ...any) {
+	c.violations = append(c.violations, fmt.Errorf("tick %v: %v", c.tick, fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestInvariantsHoldWithSourcesAndSinks(t *testing.T) {
+	w := MakeWorld(8, 8, 8)
+	w.SetSeed(3)
+	w.EnableInvariantChecks()
+	w.AddSource(2, 7, 2, WATER, 1)
+	w.AddSource(5, 7, 5, DIRT, 0.5)
+	w.FillBox(0, 0, 0, 7, 0, 3, SINK)
+	w.FillSphere(4, 4, 4, 2, WATER)
+
+	for i := 0; i < 100; i++ {
+		w.Update()
+		if err := w.Checker.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInvariantsCatchLostCells(t *testing.T) {
+	w := MakeWorld(4, 4, 4)
+	w.EnableInvariantChecks()
+	w.AddCell(1, 3, 1, DIRT)
+
+	w.Checker.beginTick(w)
+	w.Cells[1][3][1] = Cell{Type: AIR} //a bug that deletes a cell without telling anyone
+	w.Checker.endTick(w)
+
+	if w.Checker.Err() == nil {
+		t.Error("losing a dirt cell wasn't caught")
+	}
+}
+
+func TestInvariantsCatchDoubleMoves(t *testing.T) {
+	w := MakeWorld(1, 4, 1)
+	w.EnableInvariantChecks()
+	w.AddCell(0, 3, 0, DIRT)
+
+	w.Checker.beginTick(w)
+	w.SwapCells(0, 3, 0, 0, 2, 0)
+	w.SwapCells(0, 2, 0, 0, 1, 0)
+	w.Checker.endTick(w)
+
+	if w.Checker.Err() == nil {
+		t.Error("dirt falling twice in one tick wasn't caught")
+	}
+	w.Update()
+	if err := w.Checker.Err(); err != nil {
+		t.Errorf("a normal update failed the checks: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+const LIGHT_TURN_STEP = 15 //degrees the light turns around the world per key press
+
+// DirectionalLight is a light infinitely far away, like the sun, shining on the whole world from one direction
+type DirectionalLight struct {
+	Direction glm.Vec3 //the way the light shines, doesn't have to be normalised
+	Colour    glm.Vec3
+	Ambient   float32 //how much light faces get even when they face away from it
+	Specular  float32 //how bright highlights are
+	Shininess float32 //how tight highlights are
+}
+
+func DefaultLight() DirectionalLight {
+	return DirectionalLight{
+		Direction: glm.Vec3{-0.4, -1, -0.3},
+		Colour:    glm.Vec3{1, 1, 1},
+		Ambient:   0.3,
+		Specular:  0.2,
+		Shininess: 32,
+	}
+}
+
+// Apply sets the light's uniforms on s, which has to be in use
+func (l *DirectionalLight) Apply(s *shader) {
+	direction := l.Direction.Normalize()
+	s.SetVec3("LightDir", &direction)
+	s.SetVec3("LightColour", &l.Colour)
+	s.SetFloat("Ambient", l.Ambient)
+	s.SetFloat("Specular", l.Specular)
+	s.SetFloat("Shininess", l.Shininess)
+}
+
+// Turn spins the light around the vertical axis by degrees
+func (l *DirectionalLight) Turn(degrees float32) {
+	l.Direction = glm.HomogRotate3DY(glm.DegToRad(degrees)).Mul4x1(l.Direction.Vec4(0)).Vec3()
+}
+
+// formatVec3 formats vec the way parseVec3 reads it
+func formatVec3(vec glm.Vec3) string {
+	return fmt.Sprintf("%v,%v,%v", vec[0], vec[1], vec[2])
+}
+
+// parseVec3 parses three numbers separated by commas like 0.5,-1,0
+func parseVec3(text string) (glm.Vec3, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 3 {
+		return glm.Vec3{}, fmt.Errorf("%q should be 3 numbers separated by commas", text)
+	}
+	var vec glm.Vec3
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return glm.Vec3{}, fmt.Errorf("invalid number %q in %q", part, text)
+		}
+		vec[i] = float32(value)
+	}
+	return vec, nil
+}
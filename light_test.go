@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+func TestParseVec3(t *testing.T) {
+	got, err := parseVec3(" -0.4, -1 ,0.25")
+	if err != nil || got != (glm.Vec3{-0.4, -1, 0.25}) {
+		t.Errorf("parseVec3 = %v, %v", got, err)
+	}
+	if back, err := parseVec3(formatVec3(got)); err != nil || back != got {
+		t.Errorf("formatVec3 didn't round trip, got %v, %v", back, err)
+	}
+	for _, bad := range []string{"", "1,2", "1,2,3,4", "1,x,3"} {
+		if _, err := parseVec3(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestLightTurn(t *testing.T) {
+	l := DefaultLight()
+	before := l.Direction
+	for i := 0; i < 360/LIGHT_TURN_STEP; i++ {
+		l.Turn(LIGHT_TURN_STEP)
+	}
+	if !l.Direction.ApproxEqualThreshold(before, 1e-4) {
+		t.Errorf("a full turn should end where it started, went from %v to %v", before, l.Direction)
+	}
+	l.Turn(90)
+	if l.Direction.Y() != before.Y() {
+		t.Errorf("turning shouldn't change the light's height, went from %v to %v", before.Y(), l.Direction.Y())
+	}
+}
@@ -1,83 +1,146 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"image"
 	"log"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-gl/gl/v4.6-core/gl"
 	glm "github.com/go-gl/mathgl/mgl32"
 	"github.com/veandco/go-sdl2/sdl"
+
+	"sand3d/terrain"
 )
 
 const WIN_WIDTH, WIN_HEIGHT = 1000, 1000
 const FRAME_RATE = 60
-const frameDelay = 1000/FRAME_RATE
-const WORLD_SIZE = 60 //the amount of cells in each direction (so the amount of cubes should be WORLD_SIZE^3)
-const CELL_SIZE_SCALAR = 1.0 / WORLD_SIZE //scalar to use for the size of the cubes
-
-var vertices = []float32{ //the cube vertices, possible move
-	-0.5, -0.5, -0.5, 0.0, 0.0,
-	0.5, -0.5, -0.5, 1.0, 0.0,
-	0.5, 0.5, -0.5, 1.0, 1.0,
-	0.5, 0.5, -0.5, 1.0, 1.0,
-	-0.5, 0.5, -0.5, 0.0, 1.0,
-	-0.5, -0.5, -0.5, 0.0, 0.0,
-
-	-0.5, -0.5, 0.5, 0.0, 0.0,
-	0.5, -0.5, 0.5, 1.0, 0.0,
-	0.5, 0.5, 0.5, 1.0, 1.0,
-	0.5, 0.5, 0.5, 1.0, 1.0,
-	-0.5, 0.5, 0.5, 0.0, 1.0,
-	-0.5, -0.5, 0.5, 0.0, 0.0,
-
-	-0.5, 0.5, 0.5, 1.0, 0.0,
-	-0.5, 0.5, -0.5, 1.0, 1.0,
-	-0.5, -0.5, -0.5, 0.0, 1.0,
-	-0.5, -0.5, -0.5, 0.0, 1.0,
-	-0.5, -0.5, 0.5, 0.0, 0.0,
-	-0.5, 0.5, 0.5, 1.0, 0.0,
-
-	0.5, 0.5, 0.5, 1.0, 0.0,
-	0.5, 0.5, -0.5, 1.0, 1.0,
-	0.5, -0.5, -0.5, 0.0, 1.0,
-	0.5, -0.5, -0.5, 0.0, 1.0,
-	0.5, -0.5, 0.5, 0.0, 0.0,
-	0.5, 0.5, 0.5, 1.0, 0.0,
-
-	-0.5, -0.5, -0.5, 0.0, 1.0,
-	0.5, -0.5, -0.5, 1.0, 1.0,
-	0.5, -0.5, 0.5, 1.0, 0.0,
-	0.5, -0.5, 0.5, 1.0, 0.0,
-	-0.5, -0.5, 0.5, 0.0, 0.0,
-	-0.5, -0.5, -0.5, 0.0, 1.0,
-
-	-0.5, 0.5, -0.5, 0.0, 1.0,
-	0.5, 0.5, -0.5, 1.0, 1.0,
-	0.5, 0.5, 0.5, 1.0, 0.0,
-	0.5, 0.5, 0.5, 1.0, 0.0,
-	-0.5, 0.5, 0.5, 0.0, 0.0,
-	-0.5, 0.5, -0.5, 0.0, 1.0,
+const DEFAULT_WORLD_SIZE = "60x60x60" //the amount of cells in each direction
+const SOURCE_ASSET_DIR = "./data"     //where the assets are in a source checkout
+
+var vertices = []float32{ //the cube vertices as position, texture coord then face normal, possible move
+	-0.5, -0.5, -0.5, 0.0, 0.0, 0.0, 0.0, -1.0,
+	0.5, -0.5, -0.5, 1.0, 0.0, 0.0, 0.0, -1.0,
+	0.5, 0.5, -0.5, 1.0, 1.0, 0.0, 0.0, -1.0,
+	0.5, 0.5, -0.5, 1.0, 1.0, 0.0, 0.0, -1.0,
+	-0.5, 0.5, -0.5, 0.0, 1.0, 0.0, 0.0, -1.0,
+	-0.5, -0.5, -0.5, 0.0, 0.0, 0.0, 0.0, -1.0,
+
+	-0.5, -0.5, 0.5, 0.0, 0.0, 0.0, 0.0, 1.0,
+	0.5, -0.5, 0.5, 1.0, 0.0, 0.0, 0.0, 1.0,
+	0.5, 0.5, 0.5, 1.0, 1.0, 0.0, 0.0, 1.0,
+	0.5, 0.5, 0.5, 1.0, 1.0, 0.0, 0.0, 1.0,
+	-0.5, 0.5, 0.5, 0.0, 1.0, 0.0, 0.0, 1.0,
+	-0.5, -0.5, 0.5, 0.0, 0.0, 0.0, 0.0, 1.0,
+
+	-0.5, 0.5, 0.5, 1.0, 0.0, -1.0, 0.0, 0.0,
+	-0.5, 0.5, -0.5, 1.0, 1.0, -1.0, 0.0, 0.0,
+	-0.5, -0.5, -0.5, 0.0, 1.0, -1.0, 0.0, 0.0,
+	-0.5, -0.5, -0.5, 0.0, 1.0, -1.0, 0.0, 0.0,
+	-0.5, -0.5, 0.5, 0.0, 0.0, -1.0, 0.0, 0.0,
+	-0.5, 0.5, 0.5, 1.0, 0.0, -1.0, 0.0, 0.0,
+
+	0.5, 0.5, 0.5, 1.0, 0.0, 1.0, 0.0, 0.0,
+	0.5, 0.5, -0.5, 1.0, 1.0, 1.0, 0.0, 0.0,
+	0.5, -0.5, -0.5, 0.0, 1.0, 1.0, 0.0, 0.0,
+	0.5, -0.5, -0.5, 0.0, 1.0, 1.0, 0.0, 0.0,
+	0.5, -0.5, 0.5, 0.0, 0.0, 1.0, 0.0, 0.0,
+	0.5, 0.5, 0.5, 1.0, 0.0, 1.0, 0.0, 0.0,
+
+	-0.5, -0.5, -0.5, 0.0, 1.0, 0.0, -1.0, 0.0,
+	0.5, -0.5, -0.5, 1.0, 1.0, 0.0, -1.0, 0.0,
+	0.5, -0.5, 0.5, 1.0, 0.0, 0.0, -1.0, 0.0,
+	0.5, -0.5, 0.5, 1.0, 0.0, 0.0, -1.0, 0.0,
+	-0.5, -0.5, 0.5, 0.0, 0.0, 0.0, -1.0, 0.0,
+	-0.5, -0.5, -0.5, 0.0, 1.0, 0.0, -1.0, 0.0,
+
+	-0.5, 0.5, -0.5, 0.0, 1.0, 0.0, 1.0, 0.0,
+	0.5, 0.5, -0.5, 1.0, 1.0, 0.0, 1.0, 0.0,
+	0.5, 0.5, 0.5, 1.0, 0.0, 0.0, 1.0, 0.0,
+	0.5, 0.5, 0.5, 1.0, 0.0, 0.0, 1.0, 0.0,
+	-0.5, 0.5, 0.5, 0.0, 0.0, 0.0, 1.0, 0.0,
+	-0.5, 0.5, -0.5, 0.0, 1.0, 0.0, 1.0, 0.0,
 }
 
 var drawBoundingBox = true
 
 var graphics *GraphicsResources
+var waterMesh *GraphicsResources //the water's visible faces in world space, rebuilt every frame
+var refraction *WaterRefraction  //nil when refraction is turned off
+var shadowMap *ShadowMap         //nil when shadows are turned off
+var materials *Materials         //how each cell type looks
 var camera *Camera = MakeCamera(glm.Vec3{0, 0, 3}, glm.Vec3{0, 1, 0}, INIT_YAW, INIT_PITCH)
 var deltaTime, lastFrame float32
 var lastMouseX, lastMouseY int32 = WIN_WIDTH / 2, WIN_HEIGHT / 2
 var drawType int = DIRT
-var selectionY float32 = WORLD_SIZE-1 //the plane at which you make selections from
+var sourceType int = WATER //the type that placed sources spawn
+var painting bool
+var world *World
+var clock *TickClock = MakeTickClock(TICK_RATE)
+var rewind *RewindBuffer = MakeRewindBuffer(REWIND_SECONDS * TICK_RATE)
+var recorder *ReplayRecorder
+var player *ReplayPlayer //plays back a replay in the viewer when not nil
+var selectionY float32 //the plane at which you make selections from
+var config *Config
+var light DirectionalLight = DefaultLight()
+var gpuSim *GPUSim //runs the simulation when the GPU backend is on
+var screenshotRequested bool
+var frameRecorder *FrameRecorder //records what's drawn when not nil
 
 func main() {
+	var err error
+	config, err = ParseConfig(os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		log.Fatal(err)
+	}
+	if config.GPU { //the GPU only runs the block rules
+		config.UpdateMode = UpdateModeName(UPDATE_BLOCK)
+	}
+	clock.TickRate = float32(config.TickRate)
+	light.Direction, _ = parseVec3(config.LightDirection) //already checked by the config
+	light.Colour, _ = parseVec3(config.LightColour)
+	rewind = MakeRewindBuffer(int(REWIND_SECONDS * config.TickRate))
+
+	if config.RenderFile != "" {
+		runRender(config.RenderFile)
+		return
+	}
+	if config.Headless {
+		if config.Replay != "" {
+			runHeadlessReplay(config.Replay)
+		} else {
+			runHeadless()
+		}
+		return
+	}
+
 	fmt.Println("begin")
 	runtime.LockOSThread()
 
 	// ------------------------------ Window Setup ------------------------------
 
-	window, err := sdl.CreateWindow("the zinger", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, WIN_WIDTH, WIN_HEIGHT, sdl.WINDOW_OPENGL|sdl.WINDOW_ALLOW_HIGHDPI)
+	if err := sdl.Init(sdl.INIT_VIDEO); err != nil {
+		log.Fatal("could not initialize video: ", err)
+	}
+	defer sdl.Quit()
+	if config.GPU { //compute shaders need at least 4.3, some drivers only give that to core contexts
+		if err := requestCoreContext(4, 3); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var windowFlags uint32 = sdl.WINDOW_OPENGL | sdl.WINDOW_ALLOW_HIGHDPI
+	if config.Fullscreen {
+		windowFlags |= sdl.WINDOW_FULLSCREEN_DESKTOP
+	}
+	window, err := sdl.CreateWindow("the zinger", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, int32(config.WindowWidth), int32(config.WindowHeight), windowFlags)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -92,35 +155,52 @@ func main() {
 	if err := gl.Init(); err != nil {
 		log.Fatal("could not initialize OpenGL: ", err)
 	}
-	gl.Enable(gl.DEPTH_TEST)
-	gl.Viewport(0, 0, WIN_WIDTH, WIN_HEIGHT)
+	swapInterval := 0
+	if config.VSync {
+		swapInterval = 1
+	}
+	if err := sdl.GLSetSwapInterval(swapInterval); err != nil {
+		fmt.Println("could not set vsync:", err)
+	}
+	drawWidth, drawHeight := window.GLGetDrawableSize()
 	sdl.SetRelativeMouseMode(true)
 
 	// ------------------------------ Other setups ------------------------------
 
-	graphics = CreateResources(vertices)
-
-	//Shader setup
-	vertSource, err := os.ReadFile("./data/world.vs")
+	assetDir := viewerAssetDir()
+	assets := NewAssetLoader(assetDir)
+	renderer, err := NewRenderer(assets, drawWidth, drawHeight)
 	if err != nil {
 		log.Fatal(err)
 	}
-	fragSource, err := os.ReadFile("./data/world.fs")
-	if err != nil {
-		log.Fatal(err)
+	defer renderer.Delete()
+	if config.GPU {
+		if gpuSim, err = NewGPUSim(assets, materials); err != nil {
+			log.Fatal(err)
+		}
+		defer gpuSim.Delete()
 	}
-	worldShader, err := NewShader(vertSource, fragSource, "world shader")
-	if err != nil {
-		log.Fatal(err)
+
+	//shaders in the asset directory can be edited while running
+	var shaderWatcher *ShaderWatcher
+	if assetDir != "" {
+		fmt.Println("reloading shaders edited in", assetDir)
+		shaderWatcher = NewShaderWatcher(assetDir)
+		renderer.WatchShaders(shaderWatcher, assets)
+		if gpuSim != nil {
+			gpuSim.WatchShaders(shaderWatcher, assets, materials)
+		}
 	}
 
-	texture, err := NewTexture("./data/dirt.png", worldShader)
-	if err != nil {
+	if world, err = makeStartingWorld(); err != nil {
 		log.Fatal(err)
 	}
-
-	world := MakeWorld(WORLD_SIZE, WORLD_SIZE, WORLD_SIZE)
-	// world.Cells[0][20][0].Type = DIRT
+	if config.Replay != "" {
+		if err := startReplay(config.Replay); err != nil {
+			log.Fatal(err)
+		}
+	}
+	worldChanged()
 
 	// ------------------------------ Main Loop ------------------------------
 	for !handleEvents() {
@@ -129,53 +209,432 @@ func main() {
 		deltaTime = currentFrame - lastFrame
 		lastFrame = currentFrame
 
-		//clear the screen
-		gl.ClearColor(0, 0, 0, 1.0)
-		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
-
 		//update the world
-		world.Update()
-		world.Cells[10][59][10].Type = DIRT
-		world.Cells[15][59][10].Type = DIRT
-		world.Cells[10][59][15].Type = DIRT
-		world.Cells[15][59][15].Type = DIRT
-		world.Cells[30][40][10].Type = WATER
-		world.Cells[35][54][15].Type = WATER
-		world.Cells[40][27][15].Type = WATER
-
-		//bind textures
-		texture.Bind(0)
-
-		//camera stuff
-		proj := glm.Perspective(glm.DegToRad(camera.Zoom), WIN_WIDTH/WIN_HEIGHT, 0.1, 100.0)
-		worldShader.SetMat4("projection", &proj)
-		view := camera.GetViewMatrix()
-		worldShader.SetMat4("view", &view)
-
-		//draw the outer cube
-		if drawBoundingBox {
-			worldShader.SetBool("white", true)
-			gl.BindVertexArray(graphics.VAO)
-			model := glm.Ident4()
-			worldShader.SetMat4("model", &model)
-			gl.PolygonMode(gl.FRONT_AND_BACK, gl.LINE)
-			gl.DrawArrays(gl.TRIANGLES, 0, 36)
-		}
-
-		world.GetCameraCell(camera)
-		
-		//draw the world
-		gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
-		worldShader.SetBool("white", false)
-		world.Draw(worldShader)
+		for ticks := clock.Advance(deltaTime); ticks > 0; ticks-- {
+			if player != nil {
+				stepReplay()
+			}
+			world.Update()
+			if world.GPU == nil { //recording would copy the whole grid back from the GPU every tick
+				if err := rewind.Record(world); err != nil {
+					fmt.Println(err)
+				}
+			}
+			if world.Checker != nil {
+				if err := world.Checker.Err(); err != nil {
+					fmt.Println(err)
+					clock.Paused = true
+				}
+			}
+		}
+		if painting {
+			paintCell()
+		}
+
+		//pick up any edited shaders
+		shaderWatcher.Poll()
+
+		//draw the frame, saving it if a screenshot was asked for
+		renderer.Draw(camera, currentFrame)
+		if screenshotRequested {
+			screenshotRequested = false
+			saveScreenshot(renderer)
+		}
+		if frameRecorder != nil {
+			if err := frameRecorder.Frame(currentFrame, func() *image.RGBA { return ReadPixels(renderer.Width, renderer.Height) }); err != nil {
+				fmt.Println(err)
+				stopFrameRecording()
+			}
+		}
 
 		//display and then delay
 		window.GLSwap()
 		
-		elapsedTime := time.Since(startTime)
-		if elapsedTime < time.Duration(frameDelay)*time.Millisecond {
-			time.Sleep(time.Duration(frameDelay)*time.Millisecond - elapsedTime)
+		if config.FrameRate > 0 {
+			frameDelay := time.Second / time.Duration(config.FrameRate)
+			if elapsedTime := time.Since(startTime); elapsedTime < frameDelay {
+				time.Sleep(frameDelay - elapsedTime)
+			}
+		}
+	}
+	if frameRecorder != nil { //a GIF only gets written once it's stopped
+		stopFrameRecording()
+	}
+}
+
+// viewerAssetDir gets the directory the viewer loads assets from and watches shaders in. That's -assets if it's
+// set, otherwise the data directory when run from a source checkout so edits to the shaders show up live, otherwise
+// nothing and everything comes from the binary.
+func viewerAssetDir() string {
+	if config.AssetDir != "" {
+		return config.AssetDir
+	}
+	if info, err := os.Stat(SOURCE_ASSET_DIR); err == nil && info.IsDir() {
+		return SOURCE_ASSET_DIR
+	}
+	return ""
+}
+
+// requestCoreContext asks for a major.minor core profile context from the next GL context made, SDL's video has to
+// be initialised first or the request is thrown away
+func requestCoreContext(major, minor int) error {
+	attributes := []struct {
+		attr  sdl.GLattr
+		value int
+	}{
+		{sdl.GL_CONTEXT_MAJOR_VERSION, major},
+		{sdl.GL_CONTEXT_MINOR_VERSION, minor},
+		{sdl.GL_CONTEXT_PROFILE_MASK, sdl.GL_CONTEXT_PROFILE_CORE},
+	}
+	for _, attribute := range attributes {
+		if err := sdl.GLSetAttribute(attribute.attr, attribute.value); err != nil {
+			return fmt.Errorf("failed to ask for a GL %v.%v core context: %v", major, minor, err)
+		}
+	}
+	return nil
+}
+
+// parseWorldSize parses a size like 256x64x256, a single number gives a cube
+func parseWorldSize(size string) (width, height, depth int, err error) {
+	parts := strings.Split(size, "x")
+	if len(parts) == 1 {
+		parts = []string{parts[0], parts[0], parts[0]}
+	}
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("world size %q should look like WIDTHxHEIGHTxDEPTH", size)
+	}
+
+	dims := make([]int, 3)
+	for i, part := range parts {
+		dims[i], err = strconv.Atoi(part)
+		if err != nil || dims[i] <= 0 {
+			return 0, 0, 0, fmt.Errorf("invalid world size %q", size)
+		}
+	}
+	if err := checkWorldSize(dims[0], dims[1], dims[2]); err != nil {
+		return 0, 0, 0, err
+	}
+	return dims[0], dims[1], dims[2], nil
+}
+
+// makeStartingWorld makes the world to start with, either loaded from the config's load file, made by a scene script or generated terrain
+func makeStartingWorld() (*World, error) {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	var startWorld *World
+	if config.LoadFile != "" {
+		loaded, err := LoadWorldFile(config.LoadFile)
+		if err != nil {
+			return nil, err
+		}
+		startWorld = loaded
+		startWorld.SetSeed(seed)
+	} else {
+		width, height, depth, err := parseWorldSize(config.WorldSize)
+		if err != nil {
+			return nil, err
+		}
+		startWorld = MakeWorld(width, height, depth)
+		if config.Invariants { //turn them on early so scene scripts are checked too
+			startWorld.EnableInvariantChecks()
+		}
+		switch {
+		case config.Script != "":
+			script, err := os.ReadFile(config.Script)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read scene script: %v", err)
+			}
+			if startWorld, err = RunScene(script, config.Script, startWorld, seed, os.Stdout); err != nil {
+				return nil, err
+			}
+		case config.Terrain:
+			settings := terrain.DefaultSettings(seed)
+			settings.SeaLevel, settings.Roughness = config.SeaLevel, config.Roughness
+			GenerateTerrain(startWorld, settings)
+			startWorld.SetSeed(seed)
+		default:
+			script, err := NewAssetLoader(config.AssetDir).ReadFile("default.scene")
+			if err != nil {
+				return nil, err
+			}
+			if startWorld, err = RunScene(script, "default.scene", startWorld, seed, os.Stdout); err != nil {
+				return nil, err
+			}
+		}
+	}
+	startWorld.ScanOrder, _ = ParseScanOrder(config.ScanOrder) //already checked by the config
+	startWorld.UpdateMode, _ = ParseUpdateMode(config.UpdateMode)
+	if config.Invariants && startWorld.Checker == nil {
+		startWorld.EnableInvariantChecks()
+	}
+	return startWorld, nil
+}
+
+// replaceWorld swaps the current world for newWorld, stopping any recording of the old one. The new world keeps the
+// scan order and update mode the old one had, so choices made in the viewer survive loading or regenerating.
+func replaceWorld(newWorld *World) {
+	if recorder != nil {
+		stopRecording()
+	}
+	newWorld.ScanOrder = world.ScanOrder
+	newWorld.UpdateMode = world.UpdateMode
+	world = newWorld
+	worldChanged()
+}
+
+// saveScreenshot saves what the renderer just drew to the window as a PNG named after the time
+func saveScreenshot(r *Renderer) {
+	path := fmt.Sprintf(SCREENSHOT_PATTERN, time.Now().Format("20060102-150405.000"))
+	if err := SavePNG(path, ReadPixels(r.Width, r.Height)); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("saved screenshot to", path)
+}
+
+// startFrameRecording starts recording what's drawn to -record, or to a GIF named after the time without it
+func startFrameRecording() {
+	path := config.Record
+	if path == "" {
+		path = fmt.Sprintf(FRAME_RECORDING_PATTERN, time.Now().Format("20060102-150405"))
+	}
+	var err error
+	if frameRecorder, err = StartFrameRecording(path, config.RecordEvery); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("recording frames to", path)
+}
+
+// stopFrameRecording stops recording what's drawn
+func stopFrameRecording() {
+	saved, err := frameRecorder.Stop()
+	frameRecorder = nil
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("stopped recording frames after %v\n", saved)
+}
+
+// stopRecording stops recording the current world
+func stopRecording() {
+	if err := recorder.Stop(world); err != nil {
+		fmt.Println(err)
+	}
+	recorder = nil
+	fmt.Println("stopped recording")
+}
+
+// worldChanged resets everything that depends on the current world after it gets replaced
+func worldChanged() {
+	if config.Invariants && world.Checker == nil {
+		world.EnableInvariantChecks()
+	}
+	if gpuSim != nil {
+		gpuSim.Attach(world)
+	}
+	selectionY = float32(world.Height - 1)
+	world.FrameCamera(camera)
+	rewind.Reset()
+	if err := rewind.Record(world); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// runHeadlessReplay plays the replay at path to the end without opening a window
+func runHeadlessReplay(path string) {
+	replay, err := LoadReplay(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	start := time.Now()
+	finished, err := RunReplay(replay)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("replayed %v ticks in %v, final hash %x matches\n", finished.Tick-replay.StartTick, time.Since(start), finished.HashCells())
+}
+
+// runConfigTicks runs w for the config's tick count, unless it came from a scene script which runs its own.
+// afterTick is called after each one if it isn't nil.
+func runConfigTicks(w *World, afterTick func() error) error {
+	if config.Script != "" {
+		return nil
+	}
+	for i := 0; i < config.Ticks; i++ {
+		w.Update()
+		if w.Checker != nil {
+			if err := w.Checker.Err(); err != nil {
+				return err
+			}
+		}
+		if afterTick != nil {
+			if err := afterTick(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runHeadless runs the starting world for the config's tick count without opening a window
+func runHeadless() {
+	headlessWorld, err := makeStartingWorld()
+	if err != nil {
+		log.Fatal(err)
+	}
+	start := time.Now()
+	if err := runConfigTicks(headlessWorld, nil); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("ran to tick %v in %v with seed %v, final hash %x\n", headlessWorld.Tick, time.Since(start), headlessWorld.Seed, headlessWorld.HashCells())
+
+	if config.OutFile != "" {
+		if err := SaveWorldFile(headlessWorld, config.OutFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// runRender runs the starting world for the config's tick count then saves a picture of it from the config's
+// camera, recording every tick along the way with -record. It's drawn offscreen so the window is never shown,
+// which works with software GL like Mesa's.
+func runRender(path string) {
+	var err error
+	if world, err = makeStartingWorld(); err != nil {
+		log.Fatal(err)
+	}
+
+	runtime.LockOSThread()
+	if err := sdl.Init(sdl.INIT_VIDEO); err != nil {
+		log.Fatal(err)
+	}
+	defer sdl.Quit()
+	if err := requestCoreContext(3, 3); err != nil {
+		log.Fatal(err)
+	}
+	window, err := sdl.CreateWindow("the zinger", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, 1, 1, sdl.WINDOW_OPENGL|sdl.WINDOW_HIDDEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer window.Destroy()
+	context, err := window.GLCreateContext()
+	if err != nil {
+		log.Fatal("could not create context: ", err)
+	}
+	defer sdl.GLDeleteContext(context)
+	if err := gl.Init(); err != nil {
+		log.Fatal("could not initialize OpenGL: ", err)
+	}
+
+	width, height := int32(config.WindowWidth), int32(config.WindowHeight)
+	offscreen, err := NewOffscreen(width, height)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer offscreen.Delete()
+	renderer, err := NewRenderer(NewAssetLoader(config.AssetDir), width, height)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer renderer.Delete()
+
+	offscreen.Bind()
+	renderCamera := configCamera(world)
+	draw := func() *image.RGBA {
+		renderer.Draw(renderCamera, float32(world.Tick)/float32(config.TickRate))
+		return ReadPixels(width, height)
+	}
+
+	finishRecording := func() {
+		saved, err := frameRecorder.Stop()
+		frameRecorder = nil
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("recorded %v frames to %v\n", saved, config.Record)
+	}
+	var recordTick func() error
+	if config.Record != "" {
+		if frameRecorder, err = StartFrameRecording(config.Record, config.RecordEvery); err != nil {
+			log.Fatal(err)
+		}
+		recordTick = func() error {
+			if frameRecorder == nil {
+				return nil
+			}
+			err := frameRecorder.Frame(float32(world.Tick)/float32(config.TickRate), draw)
+			if err != nil && frameRecorder.Full() { //save what fits and carry on ticking to the final picture
+				fmt.Println(err)
+				finishRecording()
+				return nil
+			}
+			return err
+		}
+		if err := recordTick(); err != nil { //the starting world is the first frame
+			log.Fatal(err)
+		}
+	}
+	if err := runConfigTicks(world, recordTick); err != nil {
+		log.Fatal(err)
+	}
+	if frameRecorder != nil {
+		finishRecording()
+	}
+
+	if err := SavePNG(path, draw()); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("rendered tick %v with seed %v to %v\n", world.Tick, world.Seed, path)
+}
+
+// configCamera makes a camera looking from the config's camera position at its target, or framing the whole of w
+// if there isn't a position
+func configCamera(w *World) *Camera {
+	c := MakeCamera(glm.Vec3{0, 0, 3}, glm.Vec3{0, 1, 0}, INIT_YAW, INIT_PITCH)
+	w.FrameCamera(c)
+	if config.CameraPosition != "" {
+		c.Position, _ = parseVec3(config.CameraPosition) //already checked by the config
+		target, _ := parseVec3(config.CameraTarget)
+		c.LookAt(target)
+	}
+	return c
+}
+
+// startReplay replaces the world with the start of the replay at path and starts playing it
+func startReplay(path string) error {
+	replay, err := LoadReplay(path)
+	if err != nil {
+		return err
+	}
+	replayWorld, replayPlayer, err := replay.Start()
+	if err != nil {
+		return err
+	}
+	world, player = replayWorld, replayPlayer
+	worldChanged()
+	return nil
+}
+
+// stepReplay applies the replay's events for the coming tick, and stops playing once it reaches the end
+func stepReplay() {
+	if err := player.ApplyEvents(world); err != nil {
+		fmt.Println(err)
+		player = nil
+		return
+	}
+	if player.Done(world) {
+		if err := player.Verify(world); err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Println("replay finished")
 		}
+		player = nil
+		clock.Paused = true
 	}
 }
 
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Materials say how each cell type looks. They're loaded from materials.json, keyed by cell type name, so adding a
+// look for a new cell type or swapping a texture doesn't need a rebuild. Water is drawn by its own rules and air
+// isn't drawn at all, so neither needs one.
+
+// Material is how one cell type is drawn
+type Material struct {
+	Texture string      `json:"texture"` //image in the assets, every material's texture has to be the same size
+	Tint    *[4]float32 `json:"tint"`    //multiplied with the texture, defaults to white
+	Layer   int         `json:"-"`       //the texture's layer in the texture array
+}
+
+// Materials holds the material for every cell type along with the textures they need
+type Materials struct {
+	ByType   []Material //indexed by cell type, types without one are left empty
+	Textures []string   //the texture array's layers in order, shared between materials using the same image
+}
+
+// LoadMaterials loads and parses the material definitions from the assets
+func LoadMaterials(assets *AssetLoader) (*Materials, error) {
+	data, err := assets.ReadFile("materials.json")
+	if err != nil {
+		return nil, err
+	}
+	return ParseMaterials(data)
+}
+
+// ParseMaterials parses material definitions and works out the texture array's layers
+func ParseMaterials(data []byte) (*Materials, error) {
+	var byName map[string]Material
+	if err := json.Unmarshal(data, &byName); err != nil {
+		return nil, fmt.Errorf("failed to parse materials: %v", err)
+	}
+
+	m := &Materials{ByType: make([]Material, len(cellTypeNames))}
+	for name, material := range byName {
+		cellType, err := ParseCellType(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid material: %v", err)
+		}
+		if cellType == AIR || cellType == WATER {
+			return nil, fmt.Errorf("%v can't have a material, it isn't drawn with a texture", name)
+		}
+		if material.Texture == "" {
+			return nil, fmt.Errorf("material %v has no texture", name)
+		}
+		if material.Tint == nil {
+			material.Tint = &[4]float32{1, 1, 1, 1}
+		}
+		m.ByType[cellType] = material
+	}
+
+	//go through in cell type order so the layers don't depend on map order
+	layers := make(map[string]int)
+	for cellType := range m.ByType {
+		material := &m.ByType[cellType]
+		if material.Texture == "" {
+			continue
+		}
+		layer, ok := layers[material.Texture]
+		if !ok {
+			layer = len(m.Textures)
+			layers[material.Texture] = layer
+			m.Textures = append(m.Textures, material.Texture)
+		}
+		material.Layer = layer
+	}
+	if len(m.Textures) == 0 {
+		return nil, fmt.Errorf("no materials are defined")
+	}
+	return m, nil
+}
+
+// tint gets the cell type's tint, white for types without a material
+func (m *Materials) tint(cellType int) [4]float32 {
+	if cellType >= 0 && cellType < len(m.ByType) && m.ByType[cellType].Tint != nil {
+		return *m.ByType[cellType].Tint
+	}
+	return [4]float32{1, 1, 1, 1}
+}
+
+// layer gets the cell type's texture layer, the first one for types without a material
+func (m *Materials) layer(cellType int) int {
+	if cellType >= 0 && cellType < len(m.ByType) {
+		return m.ByType[cellType].Layer
+	}
+	return 0
+}
+
+// Apply sets the Tint and Layer uniforms for drawing a cell of cellType with s, which has to be in use
+func (m *Materials) Apply(s *shader, cellType int) {
+	tint := m.tint(cellType)
+	s.SetVec4f("Tint", tint[0], tint[1], tint[2], tint[3])
+	s.SetInt("Layer", int32(m.layer(cellType)))
+}
+
+// ApplyAll sets the MaterialTints and MaterialLayers uniform arrays, indexed by cell type, on s which has to be in use
+func (m *Materials) ApplyAll(s *shader) {
+	for cellType := range cellTypeNames {
+		tint := m.tint(cellType)
+		s.SetVec4f(fmt.Sprintf("MaterialTints[%v]", cellType), tint[0], tint[1], tint[2], tint[3])
+		s.SetInt(fmt.Sprintf("MaterialLayers[%v]", cellType), int32(m.layer(cellType)))
+	}
+}
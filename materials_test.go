@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestParseMaterials(t *testing.T) {
+	m, err := ParseMaterials([]byte(`{
+		"wall": {"texture": "b.png", "tint": [0.5, 0.5, 0.5, 1]},
+		"dirt": {"texture": "a.png"},
+		"sink": {"texture": "b.png"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//layers go in cell type order, dirt before wall, and sink shares wall's texture
+	if want := []string{"a.png", "b.png"}; len(m.Textures) != 2 || m.Textures[0] != want[0] || m.Textures[1] != want[1] {
+		t.Errorf("got textures %v, want %v", m.Textures, want)
+	}
+	for cellType, want := range map[int]int{DIRT: 0, WALL: 1, SINK: 1, SOURCE: 0} {
+		if got := m.layer(cellType); got != want {
+			t.Errorf("%v is on layer %v, want %v", CellTypeName(cellType), got, want)
+		}
+	}
+	if got := m.tint(DIRT); got != [4]float32{1, 1, 1, 1} {
+		t.Errorf("dirt's tint should default to white, got %v", got)
+	}
+	if got := m.tint(WALL); got != [4]float32{0.5, 0.5, 0.5, 1} {
+		t.Errorf("wall's tint is %v", got)
+	}
+}
+
+func TestParseMaterialsErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"lava": {"texture": "a.png"}}`,
+		`{"water": {"texture": "a.png"}}`,
+		`{"dirt": {}}`,
+		`{}`,
+		`{"dirt": `,
+	} {
+		if _, err := ParseMaterials([]byte(data)); err == nil {
+			t.Errorf("expected an error parsing %v", data)
+		}
+	}
+}
+
+// TestBuiltInMaterials checks the embedded materials load and their textures can share a texture array
+func TestBuiltInMaterials(t *testing.T) {
+	assets := NewAssetLoader("")
+	m, err := LoadMaterials(assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var width, height int32
+	for i, name := range m.Textures {
+		w, h, _, err := LoadTextureImg(assets, name)
+		if err != nil {
+			t.Fatalf("texture %v: %v", name, err)
+		}
+		if i == 0 {
+			width, height = w, h
+		} else if w != width || h != height {
+			t.Errorf("texture %v is %vx%v, the others are %vx%v", name, w, h, width, height)
+		}
+	}
+}
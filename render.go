@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+
+	"github.com/go-gl/gl/v4.6-core/gl"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// Renderer holds what's needed to draw the world, whether it's going to the window or an Offscreen framebuffer
+type Renderer struct {
+	worldShader   *shader
+	texture       *TextureArray
+	Width, Height int32
+}
+
+// NewRenderer sets up the shaders, textures and buffers for drawing width by height pixels, a GL context has to be
+// current
+func NewRenderer(assets *AssetLoader, width, height int32) (*Renderer, error) {
+	r := &Renderer{Width: width, Height: height}
+	gl.Enable(gl.DEPTH_TEST)
+	gl.Viewport(0, 0, width, height)
+
+	graphics = CreateResources(vertices)
+	waterMesh = CreateResourcesWithStride(nil, WATER_VERTEX_STRIDE)
+	if config.Refraction {
+		refraction = NewWaterRefraction(width, height)
+	}
+
+	var err error
+	if r.worldShader, err = LoadShader(assets, "world.vs", "world.fs", "world shader"); err != nil {
+		return nil, err
+	}
+	if materials, err = LoadMaterials(assets); err != nil {
+		return nil, err
+	}
+	if r.texture, err = NewTextureArray(assets, materials.Textures); err != nil {
+		return nil, err
+	}
+	r.worldShader.use()
+	r.worldShader.SetInt("Textures", 0)
+	if config.Shadows {
+		if shadowMap, err = NewShadowMap(assets, SHADOW_MAP_SIZE, float32(config.ShadowBias)); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Delete frees everything the renderer made
+func (r *Renderer) Delete() {
+	if refraction != nil {
+		refraction.Delete()
+	}
+	if shadowMap != nil {
+		shadowMap.Delete()
+	}
+	r.texture.Delete()
+	gl.DeleteProgram(r.worldShader.ID)
+}
+
+// WatchShaders has w rebuild the renderer's shaders when they're edited
+func (r *Renderer) WatchShaders(w *ShaderWatcher, assets *AssetLoader) {
+	w.WatchAssets(r.worldShader, assets, "world.vs", "world.fs", "", "world shader",
+		func(s *shader) { s.SetInt("Textures", 0) })
+	if shadowMap != nil {
+		shadowMap.WatchShaders(w, assets)
+	}
+}
+
+// Draw clears whatever framebuffer is bound and draws the world seen from cam into it, seconds drives the water's
+// waves
+func (r *Renderer) Draw(cam *Camera, seconds float32) {
+	gl.ClearColor(0, 0, 0, 1.0)
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+
+	//bind textures
+	r.texture.Bind(0)
+
+	//the shadow map and the screen both draw just the cells that are on show
+	if world.GPU != nil {
+		world.GPU.CollectVisible()
+	}
+
+	//draw the world from the light into the shadow map
+	lightProj, lightView := light.LightMatrices(world.Extents())
+	lightSpace := lightProj.Mul4(lightView)
+	if shadowMap != nil {
+		setLightUniforms := func(s *shader) {
+			s.SetMat4("projection", &lightProj)
+			s.SetMat4("view", &lightView)
+		}
+		shadowMap.Render(func(s *shader) {
+			if world.GPU != nil {
+				world.GPU.DrawShadows(setLightUniforms, world.CellSize(), graphics.VAO)
+			} else {
+				setLightUniforms(s)
+				gl.BindVertexArray(graphics.VAO)
+				world.DrawDepth(s)
+			}
+		}, r.Width, r.Height)
+	}
+
+	//camera and light stuff
+	worldShader := r.worldShader
+	proj := glm.Perspective(glm.DegToRad(cam.Zoom), float32(r.Width)/float32(r.Height), 0.1, 100.0)
+	view := cam.GetViewMatrix()
+	setFrameUniforms := func(s *shader) {
+		s.SetMat4("projection", &proj)
+		s.SetMat4("view", &view)
+		s.SetVec3("ViewPos", &cam.Position)
+		light.Apply(s)
+		s.SetFloat("AOStrength", float32(config.AOStrength))
+		SetWaterUniforms(s, seconds, world.CellSize(), refraction)
+		shadowMap.Apply(s, lightSpace)
+	}
+	worldShader.use()
+	setFrameUniforms(worldShader)
+
+	//draw the outer cube
+	if drawBoundingBox {
+		worldShader.SetBool("Unlit", true)
+		worldShader.SetVec4f("Tint", 1, 1, 1, 1)
+		gl.BindVertexArray(graphics.VAO)
+		extents := world.Extents()
+		model := glm.Scale3D(extents.X(), extents.Y(), extents.Z())
+		worldShader.SetMat4("model", &model)
+		gl.PolygonMode(gl.FRONT_AND_BACK, gl.LINE)
+		gl.DrawArrays(gl.TRIANGLES, 0, 36)
+	}
+
+	//draw the world
+	gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
+	worldShader.SetBool("Unlit", false)
+	gl.BindVertexArray(graphics.VAO)
+	if world.GPU != nil {
+		world.GPU.Draw(setFrameUniforms, world.CellSize(), graphics.VAO)
+	} else {
+		world.Draw(worldShader)
+	}
+
+	//draw the water last, furthest first, so it blends over what's behind it, without writing depth so water
+	//behind water still shows through. With refraction what's behind the water is drawn again bent by the waves
+	//first, then every layer of water blends over that.
+	if world.GPU != nil {
+		world.GPU.SortWater(cam.Position, world.CellSize())
+	} else {
+		waterMesh.Update(world.WaterMesh(cam.Position, waterMesh.Vertices))
+	}
+	gl.DepthMask(false)
+	if refraction != nil {
+		refraction.Capture()
+		r.drawWater(setFrameUniforms, true)
+	}
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	r.drawWater(setFrameUniforms, false)
+	gl.DepthMask(true)
+	gl.Disable(gl.BLEND)
+}
+
+// drawWater draws the water sorted for this frame, or with refracted what's behind it bent by the waves
+func (r *Renderer) drawWater(setFrameUniforms func(s *shader), refracted bool) {
+	if world.GPU != nil {
+		world.GPU.DrawWater(func(s *shader) {
+			setFrameUniforms(s)
+			s.SetBool("Refraction", refracted)
+		}, world.CellSize(), graphics.VAO)
+		return
+	}
+	worldShader := r.worldShader
+	model := glm.Ident4()
+	worldShader.SetMat4("model", &model)
+	worldShader.SetBool("Water", true)
+	worldShader.SetBool("Refraction", refracted)
+	worldShader.SetUVec2("AO", ^uint32(0), ^uint32(0)) //the mesh's faces aren't in cube order, so no occlusion
+	gl.BindVertexArray(waterMesh.VAO)
+	gl.DrawArrays(gl.TRIANGLES, 0, waterMesh.VertexCount())
+	worldShader.SetBool("Water", false)
+	worldShader.SetBool("Refraction", false)
+}
+
+// ------------------------------ Reading frames back ------------------------------
+
+// Offscreen is a framebuffer to draw into without showing it, so frames can be rendered without a window
+type Offscreen struct {
+	framebuffer, colour, depth uint32
+	Width, Height              int32
+}
+
+func NewOffscreen(width, height int32) (*Offscreen, error) {
+	o := &Offscreen{Width: width, Height: height}
+	gl.GenRenderbuffers(1, &o.colour)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, o.colour)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.RGBA8, width, height)
+	gl.GenRenderbuffers(1, &o.depth)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, o.depth)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT24, width, height)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+
+	gl.GenFramebuffers(1, &o.framebuffer)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, o.framebuffer)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.RENDERBUFFER, o.colour)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, o.depth)
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		o.Delete()
+		return nil, fmt.Errorf("offscreen framebuffer is incomplete: status 0x%x", status)
+	}
+	return o, nil
+}
+
+// Bind makes everything draw into the offscreen framebuffer until something else is bound
+func (o *Offscreen) Bind() {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, o.framebuffer)
+}
+
+func (o *Offscreen) Delete() {
+	gl.DeleteFramebuffers(1, &o.framebuffer)
+	gl.DeleteRenderbuffers(1, &o.colour)
+	gl.DeleteRenderbuffers(1, &o.depth)
+}
+
+// ReadPixels reads the bottom left width by height pixels of the framebuffer bound for reading into an image,
+// the right way up
+func ReadPixels(width, height int32) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 1)
+	gl.ReadPixels(0, 0, width, height, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(img.Pix))
+	flipRows(img.Pix, img.Stride, img.Rect.Dx()*4, img.Rect.Dy())
+	opaque(img)
+	return img
+}
+
+// opaque sets every pixel fully opaque, blending the water leaves alpha in the framebuffer that would make saved
+// frames see through
+func opaque(img *image.RGBA) {
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+}
+
+// SavePNG writes img to a PNG file at path
+func SavePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %v: %v", path, err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %v: %v", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %v: %v", path, err)
+	}
+	return nil
+}
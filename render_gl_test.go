@@ -0,0 +1,67 @@
+//go:build gpu
+
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+// TestRenderOffscreen draws a block into an Offscreen framebuffer and checks it shows up in the pixels read back,
+// the same way -render makes its pictures. It needs a GL context so it only builds with go test -tags gpu.
+func TestRenderOffscreen(t *testing.T) {
+	glTestContext(t, 3, 3)
+	oldConfig, oldWorld, oldBoundingBox := config, world, drawBoundingBox
+	t.Cleanup(func() {
+		config, world, drawBoundingBox = oldConfig, oldWorld, oldBoundingBox
+		refraction, shadowMap = nil, nil
+	})
+	config = DefaultConfig()
+	drawBoundingBox = false //its lines would cross the corners that should be empty
+
+	world = MakeWorld(6, 6, 6)
+	world.FillBox(1, 1, 1, 4, 4, 4, DIRT)
+
+	const size = 64
+	offscreen, err := NewOffscreen(size, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer offscreen.Delete()
+	renderer, err := NewRenderer(NewAssetLoader(""), size, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renderer.Delete()
+	offscreen.Bind()
+
+	cam := configCamera(world)
+	render := func() *image.RGBA {
+		renderer.Draw(cam, 0)
+		return ReadPixels(size, size)
+	}
+	brightness := func(img *image.RGBA, x, y int) int {
+		c := img.RGBAAt(x, y)
+		return int(c.R) + int(c.G) + int(c.B)
+	}
+
+	img := render()
+	if got := brightness(img, size/2, size/2); got < 30 {
+		t.Errorf("the block in the middle of the picture came out as %v, want it lit", img.RGBAAt(size/2, size/2))
+	}
+	for _, corner := range [][2]int{{0, 0}, {size - 1, 0}, {0, size - 1}, {size - 1, size - 1}} {
+		if got := brightness(img, corner[0], corner[1]); got != 0 {
+			t.Errorf("corner %v is %v, want the black background", corner, img.RGBAAt(corner[0], corner[1]))
+		}
+	}
+	if img.RGBAAt(size/2, size/2).A != 255 {
+		t.Errorf("read back pixels should be opaque")
+	}
+
+	//with the block gone the middle is background too
+	world.FillBox(1, 1, 1, 4, 4, 4, AIR)
+	img = render()
+	if got := brightness(img, size/2, size/2); got != 0 {
+		t.Errorf("the middle of an empty world is %v, want the black background", img.RGBAAt(size/2, size/2))
+	}
+}
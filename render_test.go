@@ -0,0 +1,61 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+func TestCameraLookAt(t *testing.T) {
+	targets := []glm.Vec3{{0, 0, 0}, {1, 2, 3}, {-4, 0, 0}, {0, -10, 0.1}}
+	for _, target := range targets {
+		c := MakeCamera(glm.Vec3{0.5, 1, 3}, glm.Vec3{0, 1, 0}, INIT_YAW, INIT_PITCH)
+		c.LookAt(target)
+		want := target.Sub(c.Position).Normalize()
+		if c.Front.Dot(want) < 0.999 {
+			t.Errorf("looking at %v the camera faces %v, want %v", target, c.Front, want)
+		}
+		if c.Right.Len() < 0.99 || c.Up.Len() < 0.99 {
+			t.Errorf("looking at %v the camera's right %v and up %v aren't unit length", target, c.Right, c.Up)
+		}
+	}
+
+	//straight down has no yaw, it's kept just off vertical so the camera still has a right
+	c := MakeCamera(glm.Vec3{0, 5, 0}, glm.Vec3{0, 1, 0}, INIT_YAW, INIT_PITCH)
+	c.LookAt(glm.Vec3{})
+	if c.Front.Y() > -0.99 || c.Right.Len() < 0.99 {
+		t.Errorf("looking straight down the camera faces %v with right %v", c.Front, c.Right)
+	}
+}
+
+func TestSavePNGOpaque(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 100
+	}
+	opaque(img)
+	path := filepath.Join(t.TempDir(), "frame.png")
+	if err := SavePNG(path, img); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	saved, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, a := saved.At(1, 1).RGBA(); r>>8 != 100 || a != 0xffff {
+		t.Errorf("saved pixel has red %v and alpha %v, want 100 and opaque", r>>8, a)
+	}
+
+	if err := SavePNG(filepath.Join(t.TempDir(), "missing", "frame.png"), img); err == nil {
+		t.Errorf("expected an error saving into a directory that doesn't exist")
+	}
+}
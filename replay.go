@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+)
+
+const REPLAY_MAGIC = "SAND3DREPLAY"
+const REPLAY_VERSION = 3
+const REPLAY_PATH = "./replay.rec"
+const MAX_REPLAY_BLOCK = 2 * MAX_CELLS_SIZE //the most a starting world or a grid in a replay can be, with room for gzip's framing
+
+const ( //replay event kinds
+	EVENT_CELL  = iota //a single cell was set
+	EVENT_CELLS        //the whole grid was replaced, like when rewinding
+	EVENT_END          //the recording stopped, holds the hash of the final grid
+	EVENT_SCAN         //the scan order was changed
+	EVENT_MODE         //the update mode was changed
+)
+
+// replayEvent is something that changed the world between ticks
+type replayEvent struct {
+	Tick    int
+	Kind    uint8
+	X, Y, Z int
+	Cell    Cell
+	Cells   []byte //the marshalled grid for EVENT_CELLS
+	Scan    int    //the new scan order for EVENT_SCAN
+	Mode    int    //the new update mode for EVENT_MODE
+}
+
+// HashCells hashes the cell grid so replays can check they ended in the same state
+func (w *World) HashCells() uint64 {
+	hash := fnv.New64a()
+	hash.Write(w.MarshalCells())
+	return hash.Sum64()
+}
+
+// ------------------------------ Recording ------------------------------
+
+// ReplayRecorder writes the seed, the starting world and every edit made to a world to a file
+type ReplayRecorder struct {
+	file *os.File
+	zw   *gzip.Writer
+	out  *bufio.Writer
+	err  error //the first write error, reported by Stop
+}
+
+// StartRecording starts recording w to the file at path, this reseeds w so playback starts from the same random state
+func StartRecording(w *World, path string) (*ReplayRecorder, error) {
+	w.SetSeed(w.Seed)
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replay file: %v", err)
+	}
+	r := &ReplayRecorder{file: file, zw: gzip.NewWriter(file)}
+	r.out = bufio.NewWriter(r.zw)
+
+	var initial bytes.Buffer
+	if err := w.Save(&initial); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to save the starting world: %v", err)
+	}
+
+	r.write([]byte(REPLAY_MAGIC), uint32(REPLAY_VERSION), w.Seed, uint8(w.ScanOrder), uint8(w.UpdateMode), uint64(w.Tick), uint32(initial.Len()), initial.Bytes())
+	if r.err != nil {
+		file.Close()
+		return nil, r.err
+	}
+	w.Recorder = r
+	return r, nil
+}
+
+// write writes each value in order, remembering the first error
+func (r *ReplayRecorder) write(values ...any) {
+	for _, value := range values {
+		if r.err != nil {
+			return
+		}
+		if err := binary.Write(r.out, binary.LittleEndian, value); err != nil {
+			r.err = fmt.Errorf("failed to write replay: %v", err)
+		}
+	}
+}
+
+// RecordCell records the cell at x,y,z being set during tick
+func (r *ReplayRecorder) RecordCell(tick, x, y, z int, cell Cell) {
+	r.write(uint64(tick), uint8(EVENT_CELL), int32(x), int32(y), int32(z),
+		uint8(cell.Type), uint8(cell.Emit), math.Float32bits(cell.Rate), math.Float32bits(cell.Charge))
+}
+
+// RecordCells records the whole grid being replaced with data during tick
+func (r *ReplayRecorder) RecordCells(tick int, data []byte) {
+	r.write(uint64(tick), uint8(EVENT_CELLS), uint32(len(data)), data)
+}
+
+// RecordScanOrder records the world's scan order being changed during tick
+func (r *ReplayRecorder) RecordScanOrder(tick, scanOrder int) {
+	r.write(uint64(tick), uint8(EVENT_SCAN), uint8(scanOrder))
+}
+
+// RecordUpdateMode records the world's update mode being changed during tick
+func (r *ReplayRecorder) RecordUpdateMode(tick, mode int) {
+	r.write(uint64(tick), uint8(EVENT_MODE), uint8(mode))
+}
+
+// Stop ends the recording of w and closes the file
+func (r *ReplayRecorder) Stop(w *World) error {
+	if w.Recorder == r {
+		w.Recorder = nil
+	}
+	r.write(uint64(w.Tick), uint8(EVENT_END), w.HashCells())
+	if r.err == nil {
+		r.err = r.out.Flush()
+	}
+	if r.err == nil {
+		r.err = r.zw.Close()
+	}
+	if err := r.file.Close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// ------------------------------ Playback ------------------------------
+
+// Replay is a recording loaded back from a file
+type Replay struct {
+	Seed       int64
+	ScanOrder  int
+	UpdateMode int
+	StartTick  int
+	Initial    []byte //the starting world in the Save format
+	Events     []replayEvent
+	EndTick    int
+	EndHash    uint64
+}
+
+// LoadReplay loads the replay at path
+func LoadReplay(path string) (*Replay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay: %v", err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay: %v", err)
+	}
+	defer zr.Close()
+	in := bufio.NewReader(zr)
+
+	read := func(values ...any) error {
+		for _, value := range values {
+			if err := binary.Read(in, binary.LittleEndian, value); err != nil {
+				return fmt.Errorf("failed to read replay: %v", err)
+			}
+		}
+		return nil
+	}
+
+	magic := make([]byte, len(REPLAY_MAGIC))
+	if _, err := io.ReadFull(in, magic); err != nil || string(magic) != REPLAY_MAGIC {
+		return nil, fmt.Errorf("not a sand3d replay")
+	}
+	var version uint32
+	replay := new(Replay)
+	if err := read(&version); err != nil {
+		return nil, err
+	}
+	if version != REPLAY_VERSION {
+		return nil, fmt.Errorf("unsupported replay version %v", version)
+	}
+	var scanOrder, updateMode uint8
+	var startTick uint64
+	var initialLen uint32
+	if err := read(&replay.Seed, &scanOrder, &updateMode, &startTick, &initialLen); err != nil {
+		return nil, err
+	}
+	replay.ScanOrder = int(scanOrder)
+	replay.UpdateMode = int(updateMode)
+	replay.StartTick = int(startTick)
+	if replay.Initial, err = readReplayBlock(in, initialLen); err != nil {
+		return nil, fmt.Errorf("failed to read the starting world: %v", err)
+	}
+
+	for {
+		var tick uint64
+		var kind uint8
+		if err := read(&tick, &kind); err != nil {
+			return nil, err
+		}
+		event := replayEvent{Tick: int(tick), Kind: kind}
+
+		switch kind {
+		case EVENT_CELL:
+			var x, y, z int32
+			var cellType, emit uint8
+			var rate, charge uint32
+			if err := read(&x, &y, &z, &cellType, &emit, &rate, &charge); err != nil {
+				return nil, err
+			}
+			event.X, event.Y, event.Z = int(x), int(y), int(z)
+			event.Cell = Cell{Type: int(cellType), Emit: int(emit), Rate: math.Float32frombits(rate), Charge: math.Float32frombits(charge)}
+		case EVENT_CELLS:
+			var length uint32
+			if err := read(&length); err != nil {
+				return nil, err
+			}
+			if event.Cells, err = readReplayBlock(in, length); err != nil {
+				return nil, fmt.Errorf("failed to read replay: %v", err)
+			}
+		case EVENT_SCAN:
+			var scanOrder uint8
+			if err := read(&scanOrder); err != nil {
+				return nil, err
+			}
+			event.Scan = int(scanOrder)
+		case EVENT_MODE:
+			var updateMode uint8
+			if err := read(&updateMode); err != nil {
+				return nil, err
+			}
+			event.Mode = int(updateMode)
+		case EVENT_END:
+			replay.EndTick = event.Tick
+			if err := read(&replay.EndHash); err != nil {
+				return nil, err
+			}
+			return replay, nil
+		default:
+			return nil, fmt.Errorf("unknown replay event %v", kind)
+		}
+		replay.Events = append(replay.Events, event)
+	}
+}
+
+// readReplayBlock reads length bytes from in. They're read as they come rather than made up front so a length
+// from a broken or hostile file can't ask for gigabytes that aren't there.
+func readReplayBlock(in io.Reader, length uint32) ([]byte, error) {
+	if length > MAX_REPLAY_BLOCK {
+		return nil, fmt.Errorf("%v bytes is more than a replay can hold", length)
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, in, int64(length)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReplayPlayer feeds a replay's events into a world as it ticks
+type ReplayPlayer struct {
+	Replay *Replay
+	next   int //the next event to apply
+}
+
+// Start makes the replay's starting world and a player for it
+func (r *Replay) Start() (*World, *ReplayPlayer, error) {
+	w, err := LoadWorld(bytes.NewReader(r.Initial))
+	if err != nil {
+		return nil, nil, err
+	}
+	w.SetSeed(r.Seed)
+	w.ScanOrder = r.ScanOrder
+	w.UpdateMode = r.UpdateMode
+	w.Tick = r.StartTick
+	return w, &ReplayPlayer{Replay: r}, nil
+}
+
+// ApplyEvents applies every event recorded before the world's current tick
+func (p *ReplayPlayer) ApplyEvents(w *World) error {
+	events := p.Replay.Events
+	for ; p.next < len(events) && events[p.next].Tick <= w.Tick; p.next++ {
+		event := events[p.next]
+		switch event.Kind {
+		case EVENT_CELL:
+			if !w.IndexInRange(event.X, event.Y, event.Z) {
+				return fmt.Errorf("replay edit out of range at %v,%v,%v", event.X, event.Y, event.Z)
+			}
+			w.Cells[event.X][event.Y][event.Z] = event.Cell
+			w.pushGPUCell(event.X, event.Y, event.Z)
+		case EVENT_CELLS:
+			if err := w.UnmarshalCells(event.Cells); err != nil {
+				return err
+			}
+		case EVENT_SCAN:
+			w.ScanOrder = event.Scan
+		case EVENT_MODE:
+			w.UpdateMode = event.Mode
+		}
+	}
+	return nil
+}
+
+// Done returns whether the world has reached the end of the replay
+func (p *ReplayPlayer) Done(w *World) bool {
+	return w.Tick >= p.Replay.EndTick
+}
+
+// Verify checks the world ended in the same state as the recording did
+func (p *ReplayPlayer) Verify(w *World) error {
+	if hash := w.HashCells(); hash != p.Replay.EndHash {
+		return fmt.Errorf("replay diverged, ended with hash %x instead of %x", hash, p.Replay.EndHash)
+	}
+	return nil
+}
+
+// RunReplay plays the whole replay without drawing anything and checks it ended in the recorded state
+func RunReplay(r *Replay) (*World, error) {
+	w, player, err := r.Start()
+	if err != nil {
+		return nil, err
+	}
+	for !player.Done(w) {
+		if err := player.ApplyEvents(w); err != nil {
+			return w, err
+		}
+		w.Update()
+	}
+	if err := player.ApplyEvents(w); err != nil {
+		return w, err
+	}
+	return w, player.Verify(w)
+}
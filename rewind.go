@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+const REWIND_SECONDS = 10 //how far back the rewind buffer goes at 1x speed
+
+// RewindBuffer is a ring buffer of compressed snapshots of the world, one per tick
+type RewindBuffer struct {
+	frames [][]byte
+	next   int //where the next frame gets written
+	count  int
+	cursor int //how many frames back from the newest we are, 0 means we're live
+}
+
+func MakeRewindBuffer(capacity int) *RewindBuffer {
+	return &RewindBuffer{frames: make([][]byte, max(capacity, 1))}
+}
+
+// Record snapshots the world as the newest frame, dropping the oldest if the buffer is full
+func (r *RewindBuffer) Record(w *World) error {
+	r.Resume()
+
+	var buf bytes.Buffer
+	zw, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(w.MarshalCells()); err != nil {
+		return fmt.Errorf("failed to compress snapshot: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress snapshot: %v", err)
+	}
+
+	r.frames[r.next] = buf.Bytes()
+	r.next = (r.next + 1) % len(r.frames)
+	r.count = min(r.count+1, len(r.frames))
+	return nil
+}
+
+// Back restores the frame one tick before the current one into w, returns false if there isn't one
+func (r *RewindBuffer) Back(w *World) (bool, error) {
+	if r.cursor+1 >= r.count {
+		return false, nil
+	}
+	r.cursor++
+	return true, r.restore(w)
+}
+
+// Forward restores the frame one tick after the current one into w, returns false if we're already live
+func (r *RewindBuffer) Forward(w *World) (bool, error) {
+	if r.cursor == 0 {
+		return false, nil
+	}
+	r.cursor--
+	return true, r.restore(w)
+}
+
+// Scrubbing returns whether we're looking at an old frame
+func (r *RewindBuffer) Scrubbing() bool {
+	return r.cursor > 0
+}
+
+// Resume drops every frame after the current one so the sim carries on from where we scrubbed to
+func (r *RewindBuffer) Resume() {
+	for ; r.cursor > 0; r.cursor-- {
+		r.next = (r.next - 1 + len(r.frames)) % len(r.frames)
+		r.frames[r.next] = nil
+		r.count--
+	}
+}
+
+// Reset empties the buffer
+func (r *RewindBuffer) Reset() {
+	clear(r.frames)
+	r.next, r.count, r.cursor = 0, 0, 0
+}
+
+// restore decompresses the frame at the cursor into w
+func (r *RewindBuffer) restore(w *World) error {
+	index := (r.next - 1 - r.cursor + 2*len(r.frames)) % len(r.frames)
+	zr := flate.NewReader(bytes.NewReader(r.frames[index]))
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return fmt.Errorf("failed to decompress snapshot: %v", err)
+	}
+	if err := w.UnmarshalCells(data); err != nil {
+		return err
+	}
+	if w.Recorder != nil {
+		w.Recorder.RecordCells(w.Tick, data)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+// recordTicks records a frame for each tick, with tick i marked by i dirt cells along the bottom
+func recordTicks(t *testing.T, r *RewindBuffer, w *World, from, to int) {
+	for tick := from; tick < to; tick++ {
+		w.FillBox(0, 0, 0, w.Width-1, 0, 0, AIR)
+		for x := 0; x < tick; x++ {
+			w.AddCell(x, 0, 0, DIRT)
+		}
+		if err := r.Record(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRewindBackToOldest(t *testing.T) {
+	w := MakeWorld(16, 1, 1)
+	r := MakeRewindBuffer(4)
+	recordTicks(t, r, w, 0, 7) //wraps around, so only ticks 3 to 6 are left
+
+	for want := 5; want >= 3; want-- {
+		if ok, err := r.Back(w); !ok || err != nil {
+			t.Fatalf("going back to tick %v got %v, %v", want, ok, err)
+		}
+		if got := w.CountCells(DIRT); got != want {
+			t.Errorf("went back to tick %v, want %v", got, want)
+		}
+	}
+	if ok, _ := r.Back(w); ok {
+		t.Errorf("went back past the oldest frame")
+	}
+	if got := w.CountCells(DIRT); got != 3 {
+		t.Errorf("a failed back changed the world to tick %v", got)
+	}
+
+	for want := 4; want <= 6; want++ {
+		if ok, err := r.Forward(w); !ok || err != nil {
+			t.Fatalf("going forward to tick %v got %v, %v", want, ok, err)
+		}
+		if got := w.CountCells(DIRT); got != want {
+			t.Errorf("went forward to tick %v, want %v", got, want)
+		}
+	}
+	if ok, _ := r.Forward(w); ok || r.Scrubbing() {
+		t.Errorf("went forward past the newest frame")
+	}
+}
+
+func TestRewindResume(t *testing.T) {
+	w := MakeWorld(16, 1, 1)
+	r := MakeRewindBuffer(4)
+	recordTicks(t, r, w, 0, 6)
+	r.Back(w)
+	r.Back(w) //at tick 3
+	if !r.Scrubbing() {
+		t.Fatal("not scrubbing after going back")
+	}
+
+	//carrying on from tick 3 drops ticks 4 and 5, across the end of the ring
+	recordTicks(t, r, w, 10, 12)
+	if r.Scrubbing() || r.count != 4 {
+		t.Fatalf("after resuming the buffer has %v frames, scrubbing %v", r.count, r.Scrubbing())
+	}
+	for _, want := range []int{10, 3, 2} {
+		if ok, err := r.Back(w); !ok || err != nil {
+			t.Fatalf("going back to tick %v got %v, %v", want, ok, err)
+		}
+		if got := w.CountCells(DIRT); got != want {
+			t.Errorf("went back to tick %v, want %v", got, want)
+		}
+	}
+	if ok, _ := r.Back(w); ok {
+		t.Errorf("went back past the oldest frame")
+	}
+}
+
+func TestRewindEmpty(t *testing.T) {
+	w := MakeWorld(2, 2, 2)
+	r := MakeRewindBuffer(0)
+	if ok, _ := r.Back(w); ok {
+		t.Errorf("went back in an empty buffer")
+	}
+	recordTicks(t, r, w, 1, 3)
+	if ok, _ := r.Back(w); ok {
+		t.Errorf("went back in a buffer that only holds one frame")
+	}
+	r.Reset()
+	if r.count != 0 || r.Scrubbing() {
+		t.Errorf("reset left %v frames", r.count)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const SAVE_MAGIC = "SAND3D"
+const SAVE_VERSION = 2 //1 stored fixed size cell records, 2 stores the cells as MarshalCells packs them
+
+const SOURCE_DATA_SIZE = 9                                      //emit byte then the rate and charge as float32s
+const MAX_CELLS_SIZE = MAX_WORLD_CELLS * (1 + SOURCE_DATA_SIZE) //the most MarshalCells can make, for the biggest world of sources
+
+// MarshalCells packs the cell grid into bytes, each cell is its type byte and sources are followed by their settings
+func (w *World) MarshalCells() []byte {
+	w.pullGPU()
+	data := make([]byte, 0, w.Width*w.Height*w.Depth)
+	for x := 0; x < w.Width; x++ {
+		for y := 0; y < w.Height; y++ {
+			for z := 0; z < w.Depth; z++ {
+				cell := w.Cells[x][y][z]
+				data = append(data, uint8(cell.Type))
+				if cell.Type == SOURCE {
+					data = append(data, uint8(cell.Emit))
+					data = binary.LittleEndian.AppendUint32(data, math.Float32bits(cell.Rate))
+					data = binary.LittleEndian.AppendUint32(data, math.Float32bits(cell.Charge))
+				}
+			}
+		}
+	}
+	return data
+}
+
+// UnmarshalCells fills the cell grid from data made by MarshalCells for a world of the same size
+func (w *World) UnmarshalCells(data []byte) error {
+	i := 0
+	for x := 0; x < w.Width; x++ {
+		for y := 0; y < w.Height; y++ {
+			for z := 0; z < w.Depth; z++ {
+				if i >= len(data) {
+					return fmt.Errorf("cell data ended early at %v,%v,%v", x, y, z)
+				}
+				cell := Cell{Type: int(data[i])}
+				i++
+				if cell.Type == SOURCE {
+					if i+SOURCE_DATA_SIZE > len(data) {
+						return fmt.Errorf("source data ended early at %v,%v,%v", x, y, z)
+					}
+					cell.Emit = int(data[i])
+					cell.Rate = math.Float32frombits(binary.LittleEndian.Uint32(data[i+1:]))
+					cell.Charge = math.Float32frombits(binary.LittleEndian.Uint32(data[i+5:]))
+					i += SOURCE_DATA_SIZE
+				}
+				w.Cells[x][y][z] = cell
+			}
+		}
+	}
+	if i != len(data) {
+		return fmt.Errorf("%v bytes of extra cell data", len(data)-i)
+	}
+	w.pushGPU()
+	return nil
+}
+
+// Save writes the world to out as a gzipped grid of cells
+func (w *World) Save(out io.Writer) error {
+	zw := gzip.NewWriter(out)
+
+	cells := w.MarshalCells()
+	header := []any{[]byte(SAVE_MAGIC), uint32(SAVE_VERSION), int32(w.Width), int32(w.Height), int32(w.Depth), uint32(len(cells))}
+	for _, field := range header {
+		if err := binary.Write(zw, binary.LittleEndian, field); err != nil {
+			return fmt.Errorf("failed to write header: %v", err)
+		}
+	}
+	if _, err := zw.Write(cells); err != nil {
+		return fmt.Errorf("failed to write cells: %v", err)
+	}
+
+	return zw.Close()
+}
+
+// LoadWorld reads a world written by Save
+func LoadWorld(in io.Reader) (*World, error) {
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open save: %v", err)
+	}
+	defer zr.Close()
+
+	magic := make([]byte, len(SAVE_MAGIC))
+	if _, err := io.ReadFull(zr, magic); err != nil || string(magic) != SAVE_MAGIC {
+		return nil, fmt.Errorf("not a sand3d save")
+	}
+
+	var version, cellsLen uint32
+	var width, height, depth int32
+	for _, field := range []any{&version, &width, &height, &depth, &cellsLen} {
+		if err := binary.Read(zr, binary.LittleEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to read header: %v", err)
+		}
+	}
+	if version != SAVE_VERSION {
+		return nil, fmt.Errorf("unsupported save version %v, this build reads version %v", version, SAVE_VERSION)
+	}
+	if err := checkWorldSize(int(width), int(height), int(depth)); err != nil {
+		return nil, err
+	}
+	//every cell takes at least its type byte, so a header can't ask for a world bigger than the data it comes with
+	cellCount := int64(width) * int64(height) * int64(depth)
+	if int64(cellsLen) < cellCount {
+		return nil, fmt.Errorf("cell data too small for a %vx%vx%v world", width, height, depth)
+	}
+	if int64(cellsLen) > cellCount*(1+SOURCE_DATA_SIZE) {
+		return nil, fmt.Errorf("cell data too large for a %vx%vx%v world", width, height, depth)
+	}
+
+	cells := make([]byte, cellsLen)
+	if _, err := io.ReadFull(zr, cells); err != nil {
+		return nil, fmt.Errorf("failed to read cells: %v", err)
+	}
+
+	world := MakeWorld(int(width), int(height), int(depth))
+	if err := world.UnmarshalCells(cells); err != nil {
+		return nil, err
+	}
+	return world, nil
+}
+
+// SaveWorldFile saves the world to the file at path
+func SaveWorldFile(w *World, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create save file: %v", err)
+	}
+	defer file.Close()
+
+	if err := w.Save(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// LoadWorldFile loads the world saved at path
+func LoadWorldFile(path string) (*World, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open save file: %v", err)
+	}
+	defer file.Close()
+
+	return LoadWorld(file)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestSaveRoundTrip(t *testing.T) {
+	w := MakeWorld(3, 4, 5)
+	w.AddCell(0, 0, 0, DIRT)
+	w.AddCell(2, 3, 4, WATER)
+	w.AddSource(1, 2, 3, WATER, 0.5)
+	var buf bytes.Buffer
+	if err := w.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadWorld(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Width != 3 || loaded.Height != 4 || loaded.Depth != 5 {
+		t.Fatalf("loaded a %vx%vx%v world", loaded.Width, loaded.Height, loaded.Depth)
+	}
+	if !bytes.Equal(loaded.MarshalCells(), w.MarshalCells()) {
+		t.Errorf("the loaded cells don't match the saved ones")
+	}
+}
+
+// saveHeader makes a save holding just a header, with cellsLen bytes of air after it
+func saveHeader(width, height, depth int32, cellsLen uint32) *bytes.Buffer {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(SAVE_MAGIC))
+	for _, field := range []any{uint32(SAVE_VERSION), width, height, depth, cellsLen} {
+		binary.Write(zw, binary.LittleEndian, field)
+	}
+	zw.Write(make([]byte, cellsLen))
+	zw.Close()
+	return &buf
+}
+
+// TestLoadBadHeader checks headers asking for worlds that are too big or don't match their data are turned away
+// before anything is made for them
+func TestLoadBadHeader(t *testing.T) {
+	for _, test := range []struct {
+		width, height, depth int32
+		cellsLen             uint32
+		want                 string
+	}{
+		{40000, 40000, 1, 0, "too big"},
+		{0, 4, 4, 0, "invalid world size"},
+		{256, 256, 256, 0, "cell data too small"},
+		{2, 2, 2, 7, "cell data too small"},
+		{2, 2, 2, 81, "cell data too large"},
+	} {
+		save := saveHeader(test.width, test.height, test.depth, test.cellsLen)
+		size := save.Len()
+		_, err := LoadWorld(save)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("loading a %v byte save of a %vx%vx%v world with %v bytes of cells got %v, want %q",
+				size, test.width, test.height, test.depth, test.cellsLen, err, test.want)
+		}
+	}
+	if _, err := LoadWorld(saveHeader(2, 2, 2, 8)); err != nil {
+		t.Errorf("loading a header that matches its cells got %v", err)
+	}
+}
+
+// TestLoadOldSaveVersion checks a save from before the cells were packed is turned away by its version rather than
+// misread as packed cells
+func TestLoadOldSaveVersion(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(SAVE_MAGIC))
+	for _, field := range []any{uint32(1), int32(2), int32(2), int32(2), uint32(8)} {
+		binary.Write(zw, binary.LittleEndian, field)
+	}
+	zw.Write(make([]byte, 8))
+	zw.Close()
+
+	_, err := LoadWorld(&buf)
+	if err == nil || !strings.Contains(err.Error(), "unsupported save version 1") {
+		t.Errorf("expected a version error loading a version 1 save, got %v", err)
+	}
+}
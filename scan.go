@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const ( //orders World.Update can visit cells in
+	SCAN_ASCENDING     = iota //x, y and z all upwards every tick, flows skew towards the low corner
+	SCAN_ALTERNATE            //flips the x and z directions each tick so the skew cancels out over 4 ticks
+	SCAN_RANDOM               //shuffles the x order each tick and the z order of each row
+	SCAN_DOUBLE_BUFFER        //moves are decided from a copy of the grid taken at the start of the tick, scanning like SCAN_ALTERNATE
+)
+
+var scanOrderNames = []string{"ascending", "alternate", "random", "double"}
+
+// ScanOrderName gets the name of the scan order
+func ScanOrderName(order int) string {
+	if order >= 0 && order < len(scanOrderNames) {
+		return scanOrderNames[order]
+	}
+	return fmt.Sprintf("scan %v", order)
+}
+
+// ParseScanOrder gets the scan order called name
+func ParseScanOrder(name string) (int, error) {
+	for order, orderName := range scanOrderNames {
+		if strings.EqualFold(name, orderName) {
+			return order, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown scan order %q, should be one of %v", name, strings.Join(scanOrderNames, ", "))
+}
+
+// SetScanOrder changes the order Update visits cells in
+func (w *World) SetScanOrder(scanOrder int) {
+	w.ScanOrder = scanOrder
+	if w.Recorder != nil {
+		w.Recorder.RecordScanOrder(w.Tick, scanOrder)
+	}
+}
+
+// axisOrder fills order with 0 to n-1, backwards if reverse is set
+func axisOrder(order []int, n int, reverse bool) []int {
+	order = order[:0]
+	for i := 0; i < n; i++ {
+		if reverse {
+			order = append(order, n-1-i)
+		} else {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// scanCells calls visit for every cell in the world's scan order
+func (w *World) scanCells(visit func(x, y, z int)) {
+	reverseX, reverseZ := false, false
+	if w.ScanOrder == SCAN_ALTERNATE || w.ScanOrder == SCAN_DOUBLE_BUFFER { //double buffering still settles conflicts in scan order
+		reverseX, reverseZ = w.Tick%2 == 1, w.Tick/2%2 == 1
+	}
+	w.xOrder = axisOrder(w.xOrder, w.Width, reverseX)
+	w.zOrder = axisOrder(w.zOrder, w.Depth, reverseZ)
+
+	if w.ScanOrder == SCAN_DOUBLE_BUFFER {
+		w.copyReadCells()
+		defer func() { w.readCells = nil }()
+	}
+
+	shuffle := w.ScanOrder == SCAN_RANDOM
+	if shuffle {
+		w.Rand.Shuffle(len(w.xOrder), func(i, j int) { w.xOrder[i], w.xOrder[j] = w.xOrder[j], w.xOrder[i] })
+	}
+	for _, x := range w.xOrder {
+		for y := 0; y < w.Height; y++ {
+			if shuffle {
+				w.Rand.Shuffle(len(w.zOrder), func(i, j int) { w.zOrder[i], w.zOrder[j] = w.zOrder[j], w.zOrder[i] })
+			}
+			for _, z := range w.zOrder {
+				visit(x, y, z)
+			}
+		}
+	}
+}
+
+// copyReadCells copies the grid into readCells so moves can be decided from the start of the tick
+func (w *World) copyReadCells() {
+	if len(w.readBuffer) != w.Width || len(w.readBuffer[0]) != w.Height || len(w.readBuffer[0][0]) != w.Depth {
+		w.readBuffer = make([][][]Cell, w.Width)
+		for x := range w.readBuffer {
+			w.readBuffer[x] = make([][]Cell, w.Height)
+			for y := range w.readBuffer[x] {
+				w.readBuffer[x][y] = make([]Cell, w.Depth)
+			}
+		}
+	}
+	for x := range w.Cells {
+		for y := range w.Cells[x] {
+			copy(w.readBuffer[x][y], w.Cells[x][y])
+		}
+	}
+	w.readCells = w.readBuffer
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// pileOffset drops a block of cellType in the middle of the floor and returns how far the middle of the
+// resulting pile ends up from the centre along x and z, averaged over a few seeds
+func pileOffset(scanOrder, updateMode, cellType int) (offsetX, offsetZ float64) {
+	const size, seeds = 31, 5
+	centre := size / 2
+	count := 0
+	for seed := int64(1); seed <= seeds; seed++ {
+		w := MakeWorld(size, 12, size)
+		w.SetSeed(seed)
+		w.ScanOrder = scanOrder
+		w.UpdateMode = updateMode
+		w.FillBox(centre-2, 0, centre-2, centre+2, 11, centre+2, cellType)
+		for i := 0; i < 60; i++ {
+			w.Update()
+		}
+
+		for x := range w.Cells {
+			for y := range w.Cells[x] {
+				for z := range w.Cells[x][y] {
+					if w.Cells[x][y][z].Type == cellType {
+						offsetX += float64(x - centre)
+						offsetZ += float64(z - centre)
+						count++
+					}
+				}
+			}
+		}
+	}
+	return offsetX / float64(count), offsetZ / float64(count)
+}
+
+func TestScanOrderSymmetry(t *testing.T) {
+	for _, scanOrder := range []int{SCAN_ALTERNATE, SCAN_RANDOM, SCAN_DOUBLE_BUFFER} {
+		for _, cellType := range []int{DIRT, WATER} {
+			offsetX, offsetZ := pileOffset(scanOrder, UPDATE_MOVE, cellType)
+			if math.Abs(offsetX) > 0.5 || math.Abs(offsetZ) > 0.5 {
+				t.Errorf("%v pile with %v scanning is off centre by %.2f, %.2f",
+					CellTypeName(cellType), ScanOrderName(scanOrder), offsetX, offsetZ)
+			}
+		}
+	}
+}
+
+// TestAscendingScanIsBiased makes sure the symmetry test can actually see the skew of the original order
+func TestAscendingScanIsBiased(t *testing.T) {
+	offsetX, offsetZ := pileOffset(SCAN_ASCENDING, UPDATE_MOVE, WATER)
+	if math.Hypot(offsetX, offsetZ) < 1 {
+		t.Errorf("expected water with ascending scanning to skew, it's only off by %.2f, %.2f", offsetX, offsetZ)
+	}
+}
+
+func TestParseScanOrder(t *testing.T) {
+	for order, name := range scanOrderNames {
+		if got, err := ParseScanOrder(name); err != nil || got != order {
+			t.Errorf("ParseScanOrder(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseScanOrder("sideways"); err == nil {
+		t.Error("expected an error for an unknown scan order")
+	}
+}
+
+func TestReplaceWorldKeepsScanOrder(t *testing.T) {
+	oldConfig, oldWorld := config, world
+	defer func() { config, world = oldConfig, oldWorld }()
+	config = DefaultConfig()
+	world = MakeWorld(4, 4, 4)
+	world.SetScanOrder(SCAN_RANDOM) //as if picked with O, the config still has its default
+
+	replaceWorld(MakeWorld(4, 4, 4))
+	if world.ScanOrder != SCAN_RANDOM {
+		t.Errorf("the new world scans %v, want the %v order picked for the old one", ScanOrderName(world.ScanOrder), ScanOrderName(SCAN_RANDOM))
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"sand3d/terrain"
+)
+
+// Scene scripts are plain text, one command per line with # starting a comment:
+//
+//	size 60 60 60                     make a new empty world, must come before anything else edits it
+//	seed 42                           seed the simulation
+//	scan alternate                    pick the order cells are updated in, see scanOrderNames
+//	mode block                        pick the rules cells move with, see updateModeNames
+//	terrain [sealevel] [roughness]    generate terrain using the seed
+//	cell x y z material               set one cell
+//	fill x1 y1 z1 x2 y2 z2 material   fill a box, corners included
+//	sphere x y z radius material      fill a ball
+//	line x1 y1 z1 x2 y2 z2 material   fill a line
+//	source x y z material [rate]      place a source spawning material, rate is cells per tick
+//	run ticks                         update the world
+//	count material                    print how many cells of material there are
+//	expect material op number         fail the script unless the count matches, op is one of == != < <= > >=
+//	echo text                         print text
+//
+// Coordinates can be given as a percentage of the world's size along that axis, like 50%.
+
+// sceneRunner holds the state of a running scene script
+type sceneRunner struct {
+	world *World
+	out   io.Writer
+	seed  int64
+	used  bool //whether anything has used the world yet, size can't come after that
+}
+
+// RunScene runs the scene script src on w with the seed, returning the world it ends up with since the script can make a new one
+func RunScene(src []byte, name string, w *World, seed int64, out io.Writer) (*World, error) {
+	runner := &sceneRunner{world: w, out: out, seed: seed}
+	w.SetSeed(seed)
+
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := runner.run(fields[0], fields[1:]); err != nil {
+			return runner.world, fmt.Errorf("%v:%v: %v", name, lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return runner.world, fmt.Errorf("failed to read %v: %v", name, err)
+	}
+	return runner.world, nil
+}
+
+// run runs a single command
+func (r *sceneRunner) run(command string, args []string) error {
+	switch command {
+	case "size":
+		if r.used {
+			return fmt.Errorf("size has to come before anything that uses the world")
+		}
+		dims, err := parseInts(args, 3, 3)
+		if err != nil {
+			return err
+		}
+		if err := checkWorldSize(dims[0], dims[1], dims[2]); err != nil {
+			return err
+		}
+		previous := r.world
+		r.world = MakeWorld(dims[0], dims[1], dims[2])
+		r.world.SetSeed(r.seed)
+		r.world.Checker, r.world.ScanOrder, r.world.UpdateMode = previous.Checker, previous.ScanOrder, previous.UpdateMode
+		return nil
+
+	case "seed":
+		if len(args) != 1 {
+			return fmt.Errorf("seed takes 1 number")
+		}
+		seed, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid seed %q", args[0])
+		}
+		r.seed = seed
+		r.world.SetSeed(seed)
+		return nil
+
+	case "scan":
+		if len(args) != 1 {
+			return fmt.Errorf("scan takes the name of a scan order")
+		}
+		scanOrder, err := ParseScanOrder(args[0])
+		if err != nil {
+			return err
+		}
+		r.world.SetScanOrder(scanOrder)
+		return nil
+
+	case "mode":
+		if len(args) != 1 {
+			return fmt.Errorf("mode takes the name of an update mode")
+		}
+		mode, err := ParseUpdateMode(args[0])
+		if err != nil {
+			return err
+		}
+		r.world.SetUpdateMode(mode)
+		return nil
+
+	case "echo":
+		fmt.Fprintln(r.out, strings.Join(args, " "))
+		return nil
+	}
+
+	r.used = true
+	w := r.world
+
+	switch command {
+	case "terrain":
+		settings := terrain.DefaultSettings(r.seed)
+		numbers, err := parseFloats(args, 0, 2)
+		if err != nil {
+			return err
+		}
+		if len(numbers) > 0 {
+			settings.SeaLevel = numbers[0]
+		}
+		if len(numbers) > 1 {
+			settings.Roughness = numbers[1]
+		}
+		GenerateTerrain(w, settings)
+
+	case "cell", "fill", "sphere", "line":
+		argCounts := map[string]int{"cell": 3, "fill": 6, "sphere": 4, "line": 6}
+		if len(args) != argCounts[command]+1 {
+			return fmt.Errorf("%v takes %v numbers and a material", command, argCounts[command])
+		}
+		cellType, err := ParseCellType(args[len(args)-1])
+		if err != nil {
+			return err
+		}
+		if command == "sphere" {
+			centre, err := r.coords(args[:3])
+			if err != nil {
+				return err
+			}
+			radius, err := strconv.ParseFloat(args[3], 32)
+			if err != nil {
+				return fmt.Errorf("invalid radius %q", args[3])
+			}
+			w.FillSphere(centre[0], centre[1], centre[2], float32(radius), cellType)
+			return nil
+		}
+		p, err := r.coords(args[:len(args)-1])
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "cell":
+			w.AddCell(p[0], p[1], p[2], cellType)
+		case "fill":
+			w.FillBox(p[0], p[1], p[2], p[3], p[4], p[5], cellType)
+		case "line":
+			w.FillLine(p[0], p[1], p[2], p[3], p[4], p[5], cellType)
+		}
+
+	case "source":
+		if len(args) != 4 && len(args) != 5 {
+			return fmt.Errorf("source takes a position, a material and an optional rate")
+		}
+		p, err := r.coords(args[:3])
+		if err != nil {
+			return err
+		}
+		emitType, err := ParseCellType(args[3])
+		if err != nil {
+			return err
+		}
+		rate := 1.0
+		if len(args) == 5 {
+			if rate, err = strconv.ParseFloat(args[4], 32); err != nil || rate < 0 {
+				return fmt.Errorf("invalid rate %q", args[4])
+			}
+		}
+		w.AddSource(p[0], p[1], p[2], emitType, float32(rate))
+
+	case "run":
+		ticks, err := parseInts(args, 1, 1)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < ticks[0]; i++ {
+			w.Update()
+			if w.Checker != nil {
+				if err := w.Checker.Err(); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "count":
+		if len(args) != 1 {
+			return fmt.Errorf("count takes a material")
+		}
+		cellType, err := ParseCellType(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "%v: %v\n", CellTypeName(cellType), w.CountCells(cellType))
+
+	case "expect":
+		if len(args) != 3 {
+			return fmt.Errorf("expect takes a material, a comparison and a number")
+		}
+		cellType, err := ParseCellType(args[0])
+		if err != nil {
+			return err
+		}
+		want, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid number %q", args[2])
+		}
+		count := w.CountCells(cellType)
+		passed, err := compare(count, args[1], want)
+		if err != nil {
+			return err
+		}
+		if !passed {
+			return fmt.Errorf("expected %v %v %v but there are %v", CellTypeName(cellType), args[1], want, count)
+		}
+
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+	return nil
+}
+
+// coords parses x,y,z triples, percentages are a fraction of the world along that axis
+func (r *sceneRunner) coords(args []string) ([]int, error) {
+	sizes := []int{r.world.Width, r.world.Height, r.world.Depth}
+	coords := make([]int, len(args))
+	for i, arg := range args {
+		if percent, ok := strings.CutSuffix(arg, "%"); ok {
+			value, err := strconv.ParseFloat(percent, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid coordinate %q", arg)
+			}
+			coords[i] = int(math.Round(value / 100 * float64(sizes[i%3]-1)))
+			continue
+		}
+		value, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q", arg)
+		}
+		coords[i] = value
+	}
+	return coords, nil
+}
+
+// parseInts parses between minCount and maxCount whole numbers
+func parseInts(args []string, minCount, maxCount int) ([]int, error) {
+	if len(args) < minCount || len(args) > maxCount {
+		return nil, fmt.Errorf("expected %v numbers but got %v", minCount, len(args))
+	}
+	numbers := make([]int, len(args))
+	for i, arg := range args {
+		number, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", arg)
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// parseFloats parses between minCount and maxCount numbers
+func parseFloats(args []string, minCount, maxCount int) ([]float64, error) {
+	if len(args) < minCount || len(args) > maxCount {
+		return nil, fmt.Errorf("expected at most %v numbers but got %v", maxCount, len(args))
+	}
+	numbers := make([]float64, len(args))
+	for i, arg := range args {
+		number, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", arg)
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// compare compares a and b with the comparison op
+func compare(a int, op string, b int) (bool, error) {
+	switch op {
+	case "==":
+		return a == b, nil
+	case "!=":
+		return a != b, nil
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	}
+	return false, fmt.Errorf("unknown comparison %q", op)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// runTestScene runs src on a small empty world, returning the world it made and what it printed
+func runTestScene(t *testing.T, src string) (*World, string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := RunScene([]byte(src), "test.scene", MakeWorld(4, 4, 4), 1, &out)
+	return w, out.String(), err
+}
+
+func TestSceneShapes(t *testing.T) {
+	w, out, err := runTestScene(t, `
+		size 11 11 11   # comments are ignored
+		fill 0 0 0 2 2 2 wall
+		sphere 50% 50% 50% 1 dirt
+		line 0 10 0 10 10 10 water
+		cell 100% 0 100% sink
+		count wall
+		count dirt
+		expect water == 11
+		expect sink >= 1
+		expect air != 0
+		echo done
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Width != 11 || w.Height != 11 || w.Depth != 11 {
+		t.Fatalf("size made a %vx%vx%v world", w.Width, w.Height, w.Depth)
+	}
+	//a radius 1 ball is the centre and its 6 neighbours
+	for cellType, want := range map[int]int{WALL: 27, DIRT: 7, WATER: 11, SINK: 1} {
+		if got := w.CountCells(cellType); got != want {
+			t.Errorf("there are %v %v cells, want %v", got, CellTypeName(cellType), want)
+		}
+	}
+	if w.Cells[5][5][5].Type != DIRT || w.Cells[10][0][10].Type != SINK || w.Cells[5][10][5].Type != WATER {
+		t.Errorf("percentages or the line put cells in the wrong places")
+	}
+	if want := "wall: 27\ndirt: 7\ndone\n"; out != want {
+		t.Errorf("the scene printed %q, want %q", out, want)
+	}
+}
+
+func TestSceneRun(t *testing.T) {
+	w, _, err := runTestScene(t, `
+		size 6 6 6
+		seed 3
+		mode block
+		source 2 5 2 dirt 1
+		run 10
+		expect dirt > 0
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Tick != 10 || w.Seed != 3 || w.UpdateMode != UPDATE_BLOCK {
+		t.Errorf("ran to tick %v with seed %v and update mode %v", w.Tick, w.Seed, UpdateModeName(w.UpdateMode))
+	}
+}
+
+func TestSceneErrors(t *testing.T) {
+	for _, test := range []struct {
+		src, want string
+	}{
+		{"bogus", "test.scene:1: unknown command"},
+		{"echo hi\n\nfill 0 0 0 1 1 wall", "test.scene:3: fill takes 6 numbers and a material"},
+		{"cell 0 0 0 lava", `unknown cell type "lava"`},
+		{"cell 0 x 0 dirt", `invalid coordinate "x"`},
+		{"cell 0 y% 0 dirt", `invalid coordinate "y%"`},
+		{"sphere 1 1 1 big dirt", `invalid radius "big"`},
+		{"source 1 1 1 water -2", `invalid rate "-2"`},
+		{"source 1 1 1", "source takes a position"},
+		{"cell 0 0 0 dirt\nsize 8 8 8", "test.scene:2: size has to come before"},
+		{"size 8 0 8", "invalid world size"},
+		{"size 2000 8 8", "too big"},
+		{"size 8 8", "expected 3 numbers"},
+		{"seed abc", `invalid seed "abc"`},
+		{"scan sideways", "unknown scan order"},
+		{"mode teleport", "unknown update mode"},
+		{"terrain 0.5 0.5 0.5", "expected at most 2 numbers"},
+		{"run", "expected 1 numbers"},
+		{"count", "count takes a material"},
+		{"expect dirt == x", `invalid number "x"`},
+		{"expect dirt ~ 0", `unknown comparison "~"`},
+		{"cell 0 0 0 dirt\nexpect dirt > 1", "expected dirt > 1 but there are 1"},
+	} {
+		if _, _, err := runTestScene(t, test.src); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: expected an error containing %q, got %v", test.src, test.want, err)
+		}
+	}
+}
+
+func TestDefaultScene(t *testing.T) {
+	script, err := NewAssetLoader("").ReadFile("default.scene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := RunScene(script, "default.scene", MakeWorld(20, 20, 20), 1, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.CountCells(SOURCE) != 7 {
+		t.Errorf("the default scene placed %v sources, want 7", w.CountCells(SOURCE))
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 type shader struct {
 	ID uint32 //program ID
+	uniforms map[string]int32 //uniform locations looked up so far, -1 for ones the program doesn't have
 }
 
 func NewShader(vertexShaderSource, fragmentShaderSource []byte, name string) (*shader, error) {
@@ -31,10 +32,71 @@ func NewShader(vertexShaderSource, fragmentShaderSource []byte, name string) (*s
 
 	gl.DeleteShader(vertexShader)
 	gl.DeleteShader(fragmentShader)
+	if err := checkLink(newShader.ID); err != nil {
+		return nil, fmt.Errorf("Unable to link Shader at %v\n%v", name, err)
+	}
 	
 	return newShader, nil
 }
 
+// LoadShader loads and compiles the vertex and fragment shader assets into a shader
+func LoadShader(assets *AssetLoader, vertexName, fragmentName, name string) (*shader, error) {
+	return LoadShaderWithDefines(assets, vertexName, fragmentName, "", name)
+}
+
+// LoadShaderWithDefines is LoadShader with defines put in after the vertex shader's #version line
+func LoadShaderWithDefines(assets *AssetLoader, vertexName, fragmentName, defines, name string) (*shader, error) {
+	vertexSource, err := assets.ReadFile(vertexName)
+	if err != nil {
+		return nil, err
+	}
+	fragmentSource, err := assets.ReadFile(fragmentName)
+	if err != nil {
+		return nil, err
+	}
+	return NewShader(injectDefines(vertexSource, defines), fragmentSource, name)
+}
+
+// NewComputeShader compiles a compute shader into its own program
+func NewComputeShader(computeShaderSource []byte, name string) (*shader, error) {
+	newShader := new(shader)
+
+	computeShader, err := compileShader(string(computeShaderSource), gl.COMPUTE_SHADER)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to compile compute Shader at %v\n%v", name, err)
+	}
+
+	newShader.ID = gl.CreateProgram()
+	gl.AttachShader(newShader.ID, computeShader)
+	gl.LinkProgram(newShader.ID)
+
+	gl.DeleteShader(computeShader)
+	if err := checkLink(newShader.ID); err != nil {
+		return nil, fmt.Errorf("Unable to link compute Shader at %v\n%v", name, err)
+	}
+
+	return newShader, nil
+}
+
+// LoadComputeShader loads and compiles the compute shader asset, defines are put in after the #version line
+func LoadComputeShader(assets *AssetLoader, computeName, defines string) (*shader, error) {
+	source, err := assets.ReadFile(computeName)
+	if err != nil {
+		return nil, err
+	}
+	return NewComputeShader(injectDefines(source, defines), computeName)
+}
+
+// injectDefines puts defines straight after the #version line of source, which has to come first
+func injectDefines(source []byte, defines string) []byte {
+	text := string(source)
+	end := strings.Index(text, "\n") + 1
+	if !strings.HasPrefix(text, "#version") || end == 0 {
+		return []byte(defines + text)
+	}
+	return []byte(text[:end] + defines + text[end:])
+}
+
 func compileShader(shaderCode string, shaderType uint32) (uint32, error) {
 	var shader uint32
 
@@ -59,58 +121,105 @@ func compileShader(shaderCode string, shaderType uint32) (uint32, error) {
 	return shader, nil
 }
 
+// checkLink checks program linked, deleting it and returning the info log if it didn't
+func checkLink(program uint32) error {
+	var status int32
+	gl.GetProgramiv(program, gl.LINK_STATUS, &status)
+	if status == gl.TRUE {
+		return nil
+	}
+	var logLength int32
+	gl.GetProgramiv(program, gl.INFO_LOG_LENGTH, &logLength)
+	log := strings.Repeat("\x00", int(logLength+1))
+	gl.GetProgramInfoLog(program, logLength, nil, gl.Str(log))
+	gl.DeleteProgram(program)
+	return fmt.Errorf("failed to link\n%v", strings.TrimRight(log, "\x00"))
+}
+
+// replace swaps s over to other's program and deletes its old one, so everything holding s uses the new program
+func (s *shader) replace(other *shader) {
+	gl.DeleteProgram(s.ID)
+	s.ID = other.ID
+	s.uniforms = nil
+}
+
 func (s *shader) use() {
 	gl.UseProgram(s.ID)
 }
 
+// location gets the location of the uniform called name, only asking GL the first time
+func (s *shader) location(name string) int32 {
+	if location, ok := s.uniforms[name]; ok {
+		return location
+	}
+	if s.uniforms == nil {
+		s.uniforms = make(map[string]int32)
+	}
+	location := gl.GetUniformLocation(s.ID, gl.Str(name+"\x00"))
+	s.uniforms[name] = location
+	return location
+}
+
 func (s *shader) SetBool(name string, value bool) {
 	var intVal int32
 	if value {
 		intVal = 1
 	}
-	gl.Uniform1i(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), intVal)
+	gl.Uniform1i(s.location(name), intVal)
 }
 
 func (s *shader) SetInt(name string, value int32) {
-	gl.Uniform1i(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), value)
+	gl.Uniform1i(s.location(name), value)
+}
+
+func (s *shader) SetUint(name string, value uint32) {
+	gl.Uniform1ui(s.location(name), value)
+}
+
+func (s *shader) SetUVec2(name string, x, y uint32) {
+	gl.Uniform2ui(s.location(name), x, y)
+}
+
+func (s *shader) SetIVec3(name string, x, y, z int32) {
+	gl.Uniform3i(s.location(name), x, y, z)
 }
 
 func (s *shader) SetFloat(name string, value float32) {
-	gl.Uniform1f(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), value)
+	gl.Uniform1f(s.location(name), value)
 }
 
 func (s *shader) SetVec2(name string, value *mgl32.Vec2) {
-	gl.Uniform2fv(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), 1, &value[0])
+	gl.Uniform2fv(s.location(name), 1, &value[0])
 }
 
 func (s *shader) SetVec2f(name string, x, y float32) {
-	gl.Uniform2f(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), x, y)
+	gl.Uniform2f(s.location(name), x, y)
 }
 
 func (s *shader) SetVec3(name string, value *mgl32.Vec3) {
-	gl.Uniform3fv(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), 1, &value[0])
+	gl.Uniform3fv(s.location(name), 1, &value[0])
 }
 
 func (s *shader) SetVec3f(name string, x, y, z float32) {
-	gl.Uniform3f(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), x, y, z)
+	gl.Uniform3f(s.location(name), x, y, z)
 }
 
 func (s *shader) SetVec4(name string, value *mgl32.Vec4) {
-	gl.Uniform4fv(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), 1, &value[0])
+	gl.Uniform4fv(s.location(name), 1, &value[0])
 }
 
 func (s *shader) SetVec4f(name string, x, y, z, w float32) {
-	gl.Uniform4f(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), x, y, z, w)
+	gl.Uniform4f(s.location(name), x, y, z, w)
 }
 
 func (s *shader) SetMat2(name string, mat *mgl32.Mat2) {
-	gl.UniformMatrix2fv(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), 1, false, &(*mat)[0])
+	gl.UniformMatrix2fv(s.location(name), 1, false, &(*mat)[0])
 }
 
 func (s *shader) SetMat3(name string, mat *mgl32.Mat3) {
-	gl.UniformMatrix3fv(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), 1, false, &(*mat)[0])
+	gl.UniformMatrix3fv(s.location(name), 1, false, &(*mat)[0])
 }
 
 func (s *shader) SetMat4(name string, mat *mgl32.Mat4) {
-	gl.UniformMatrix4fv(gl.GetUniformLocation(s.ID, gl.Str(name+"\x00")), 1, false, &(*mat)[0])
+	gl.UniformMatrix4fv(s.location(name), 1, false, &(*mat)[0])
 }
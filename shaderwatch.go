@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Shaders can be edited while the viewer is running, in the directory given with -assets or in data. The watcher
+// polls the source files in that directory and rebuilds any shader built from one that has changed, keeping the
+// old program if the new one doesn't compile so a typo doesn't kill the viewer.
+
+const SHADER_POLL_INTERVAL = 500 * time.Millisecond
+
+// watchedShader is a shader along with how to build it again
+type watchedShader struct {
+	shader *shader
+	name   string
+	files  []string                //the asset names it's built from
+	build  func() (*shader, error) //compiles a fresh program from the current assets
+	setup  func(s *shader)         //sets uniforms that are only set once, like samplers, can be nil
+	times  map[string]time.Time    //when each file was last modified
+}
+
+// ShaderWatcher rebuilds shaders when their source files in dir change
+type ShaderWatcher struct {
+	dir      string
+	shaders  []*watchedShader
+	lastPoll time.Time
+}
+
+func NewShaderWatcher(dir string) *ShaderWatcher {
+	return &ShaderWatcher{dir: dir}
+}
+
+// Watch rebuilds s with build whenever one of files changes, then calls setup with it in use
+func (w *ShaderWatcher) Watch(s *shader, name string, files []string, build func() (*shader, error), setup func(s *shader)) {
+	watched := &watchedShader{shader: s, name: name, files: files, build: build, setup: setup, times: make(map[string]time.Time)}
+	w.changed(watched) //note down the current times
+	w.shaders = append(w.shaders, watched)
+}
+
+// WatchAssets watches a shader loaded with LoadShaderWithDefines
+func (w *ShaderWatcher) WatchAssets(s *shader, assets *AssetLoader, vertexName, fragmentName, defines, name string, setup func(s *shader)) {
+	w.Watch(s, name, []string{vertexName, fragmentName}, func() (*shader, error) {
+		return LoadShaderWithDefines(assets, vertexName, fragmentName, defines, name)
+	}, setup)
+}
+
+// changed gets whether any of the shader's files have been modified since it was last checked. A file that isn't
+// in dir, because it's only built in, counts as changed when it appears and again if it's taken away.
+func (w *ShaderWatcher) changed(watched *watchedShader) bool {
+	changed := false
+	for _, file := range watched.files {
+		var modTime time.Time //stays zero while the file isn't there
+		if info, err := os.Stat(filepath.Join(w.dir, file)); err == nil {
+			modTime = info.ModTime()
+		}
+		if last, ok := watched.times[file]; ok && !modTime.Equal(last) {
+			changed = true
+		}
+		watched.times[file] = modTime
+	}
+	return changed
+}
+
+// Poll rebuilds the shaders whose files have changed, at most once every SHADER_POLL_INTERVAL
+func (w *ShaderWatcher) Poll() {
+	if w == nil || time.Since(w.lastPoll) < SHADER_POLL_INTERVAL {
+		return
+	}
+	w.lastPoll = time.Now()
+	for _, watched := range w.shaders {
+		if !w.changed(watched) {
+			continue
+		}
+		rebuilt, err := watched.build()
+		if err != nil {
+			fmt.Printf("keeping the old %v: %v\n", watched.name, err)
+			continue
+		}
+		watched.shader.replace(rebuilt)
+		if watched.setup != nil {
+			watched.shader.use()
+			watched.setup(watched.shader)
+		}
+		fmt.Println("reloaded", watched.name)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShaderWatcherChanged(t *testing.T) {
+	dir := t.TempDir()
+	vertexPath := filepath.Join(dir, "test.vs")
+	if err := os.WriteFile(vertexPath, []byte("#version 330 core\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewShaderWatcher(dir)
+	//test.fs isn't in the directory, like a shader that's only built in
+	w.Watch(&shader{}, "test shader", []string{"test.vs", "test.fs"}, nil, nil)
+	watched := w.shaders[0]
+	if w.changed(watched) {
+		t.Errorf("nothing has been edited yet")
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(vertexPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !w.changed(watched) {
+		t.Errorf("editing the vertex shader should be noticed")
+	}
+	if w.changed(watched) {
+		t.Errorf("the same edit shouldn't be noticed twice")
+	}
+
+	//copying a built in shader into the directory to edit it is a change, and so is taking it away again
+	fragmentPath := filepath.Join(dir, "test.fs")
+	if err := os.WriteFile(fragmentPath, []byte("#version 330 core\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !w.changed(watched) {
+		t.Errorf("adding the fragment shader should be noticed")
+	}
+	if err := os.Remove(fragmentPath); err != nil {
+		t.Fatal(err)
+	}
+	if !w.changed(watched) {
+		t.Errorf("removing the fragment shader should be noticed")
+	}
+	if w.changed(watched) {
+		t.Errorf("a file staying away shouldn't be noticed twice")
+	}
+}
+
+func TestShaderWatcherNil(t *testing.T) {
+	var w *ShaderWatcher
+	w.Poll() //watching is off without an asset directory, polling should do nothing
+}
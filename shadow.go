@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-gl/gl/v4.6-core/gl"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// Shadows come from a shadow map: before the world is drawn it's drawn again from the light's point of view keeping
+// only depth, then world.fs checks whether anything in the map is closer to the light than what it's lighting.
+// Water doesn't cast shadows.
+
+const SHADOW_MAP_SIZE = 2048
+const SHADOW_TEXTURE_UNIT = 2
+const DEFAULT_SHADOW_BIAS = 0.002 //depth added before comparing so faces don't shadow themselves, in shadow map depth
+const SHADOW_PCF_RADIUS = 1       //shadow map texels sampled either side of each one to soften shadow edges
+
+// ShadowMap holds the depth texture drawn from the light and what's needed to draw into it
+type ShadowMap struct {
+	framebuffer, texture uint32
+	size                 int32
+	shader               *shader
+	Bias                 float32
+}
+
+func NewShadowMap(assets *AssetLoader, size int32, bias float32) (*ShadowMap, error) {
+	s := &ShadowMap{size: size, Bias: bias}
+	var err error
+	if s.shader, err = LoadShader(assets, "shadow.vs", "shadow.fs", "shadow shader"); err != nil {
+		return nil, err
+	}
+
+	gl.GenTextures(1, &s.texture)
+	gl.BindTexture(gl.TEXTURE_2D, s.texture)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.DEPTH_COMPONENT24, size, size, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_BORDER)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_BORDER)
+	border := [4]float32{1, 1, 1, 1} //past the edges counts as lit
+	gl.TexParameterfv(gl.TEXTURE_2D, gl.TEXTURE_BORDER_COLOR, &border[0])
+
+	gl.GenFramebuffers(1, &s.framebuffer)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, s.framebuffer)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, s.texture, 0)
+	gl.DrawBuffer(gl.NONE)
+	gl.ReadBuffer(gl.NONE)
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		s.Delete()
+		return nil, fmt.Errorf("shadow map framebuffer is incomplete: status 0x%x", status)
+	}
+	return s, nil
+}
+
+// WatchShaders has w rebuild the shadow shader when it's edited
+func (s *ShadowMap) WatchShaders(w *ShaderWatcher, assets *AssetLoader) {
+	w.WatchAssets(s.shader, assets, "shadow.vs", "shadow.fs", "", "shadow shader", nil)
+}
+
+func (s *ShadowMap) Delete() {
+	gl.DeleteFramebuffers(1, &s.framebuffer)
+	gl.DeleteTextures(1, &s.texture)
+	gl.DeleteProgram(s.shader.ID)
+}
+
+// LightMatrices gets the light's projection and view, looking along its direction at a box around a world of
+// the given extents centred on the origin
+func (l *DirectionalLight) LightMatrices(extents glm.Vec3) (projection, view glm.Mat4) {
+	radius := extents.Len() / 2
+	direction := l.Direction.Normalize()
+	up := glm.Vec3{0, 1, 0}
+	if abs := direction.Y(); abs > 0.99 || abs < -0.99 { //looking straight down, up can't be along the direction
+		up = glm.Vec3{0, 0, 1}
+	}
+	eye := direction.Mul(-2 * radius)
+	view = glm.LookAtV(eye, glm.Vec3{}, up)
+	projection = glm.Ortho(-radius, radius, -radius, radius, radius, 3*radius)
+	return projection, view
+}
+
+// Render draws the shadow map. draw is called with the depth only shader in use to draw the cells with the light's
+// projection and view, then the framebuffer that was bound before and the screen's viewport are put back.
+func (s *ShadowMap) Render(draw func(s *shader), screenWidth, screenHeight int32) {
+	var previous int32
+	gl.GetIntegerv(gl.FRAMEBUFFER_BINDING, &previous)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, s.framebuffer)
+	gl.Viewport(0, 0, s.size, s.size)
+	gl.Clear(gl.DEPTH_BUFFER_BIT)
+	s.shader.use()
+	draw(s.shader)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, uint32(previous))
+	gl.Viewport(0, 0, screenWidth, screenHeight)
+}
+
+// Apply binds the shadow map and sets the uniforms world.fs samples it with on sh, which has to be in use.
+// s can be nil to turn shadows off.
+func (s *ShadowMap) Apply(sh *shader, lightSpace glm.Mat4) {
+	sh.SetBool("Shadows", s != nil)
+	if s == nil {
+		return
+	}
+	gl.ActiveTexture(gl.TEXTURE0 + SHADOW_TEXTURE_UNIT)
+	gl.BindTexture(gl.TEXTURE_2D, s.texture)
+	gl.ActiveTexture(gl.TEXTURE0)
+	sh.SetInt("ShadowMap", SHADOW_TEXTURE_UNIT)
+	sh.SetMat4("LightSpace", &lightSpace)
+	sh.SetFloat("ShadowBias", s.Bias)
+	sh.SetInt("ShadowPCFRadius", SHADOW_PCF_RADIUS)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// TestLightMatricesCoverWorld checks every corner of the world lands inside the shadow map whichever way the light
+// shines, including straight down where the usual up vector doesn't work
+func TestLightMatricesCoverWorld(t *testing.T) {
+	extents := glm.Vec3{2, 1, 3}
+	directions := []glm.Vec3{DefaultLight().Direction, {0, -1, 0}, {1, 0, 0}, {0.3, 0.2, -1}}
+	for _, direction := range directions {
+		light := DirectionalLight{Direction: direction}
+		projection, view := light.LightMatrices(extents)
+		lightSpace := projection.Mul4(view)
+		for corner := 0; corner < 8; corner++ {
+			pos := glm.Vec3{float32(corner&1) - 0.5, float32(corner>>1&1) - 0.5, float32(corner>>2&1) - 0.5}
+			for axis := range pos {
+				pos[axis] *= extents[axis]
+			}
+			clip := lightSpace.Mul4x1(pos.Vec4(1))
+			for axis := 0; axis < 3; axis++ {
+				if n := clip[axis] / clip[3]; n < -1.0001 || n > 1.0001 {
+					t.Errorf("light %v: corner %v is outside the shadow map at %v", direction, pos, clip.Vec3())
+					break
+				}
+			}
+		}
+	}
+}
+
+// TestLightMatricesDepthOrder checks things nearer the light get smaller depths, which the shadow test relies on
+func TestLightMatricesDepthOrder(t *testing.T) {
+	light := DefaultLight()
+	projection, view := light.LightMatrices(glm.Vec3{1, 1, 1})
+	lightSpace := projection.Mul4(view)
+	near := lightSpace.Mul4x1(light.Direction.Normalize().Mul(-0.4).Vec4(1))
+	far := lightSpace.Mul4x1(light.Direction.Normalize().Mul(0.4).Vec4(1))
+	if near.Z() >= far.Z() {
+		t.Errorf("the point nearer the light has depth %v, not less than the further one's %v", near.Z(), far.Z())
+	}
+}
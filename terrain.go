@@ -0,0 +1,14 @@
+package main
+
+import "sand3d/terrain"
+
+// terrainCellTypes maps each kind of generated terrain to the cell type it's made of
+var terrainCellTypes = [...]int{terrain.AIR: AIR, terrain.STONE: WALL, terrain.DIRT: DIRT, terrain.WATER: WATER}
+
+// GenerateTerrain replaces the world's cells with layered stone and dirt hills, caves and lakes
+func GenerateTerrain(w *World, settings terrain.Settings) {
+	w.ResetCellGrid(w.Width, w.Height, w.Depth)
+	terrain.Generate(w.Width, w.Height, w.Depth, settings, func(x, y, z, kind int) {
+		w.Cells[x][y][z] = Cell{Type: terrainCellTypes[kind]}
+	})
+}
@@ -0,0 +1,84 @@
+package terrain
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Noise is seeded 3d perlin noise
+type Noise struct {
+	perm [512]int
+}
+
+func NewNoise(seed int64) *Noise {
+	n := new(Noise)
+	shuffled := rand.New(rand.NewSource(seed)).Perm(256)
+	for i := range n.perm {
+		n.perm[i] = shuffled[i%256]
+	}
+	return n
+}
+
+// At gets the noise at x,y,z, it's roughly between -1 and 1
+func (n *Noise) At(x, y, z float64) float64 {
+	floorX, floorY, floorZ := math.Floor(x), math.Floor(y), math.Floor(z)
+	cubeX, cubeY, cubeZ := int(floorX)&255, int(floorY)&255, int(floorZ)&255
+	x, y, z = x-floorX, y-floorY, z-floorZ
+	u, v, w := fade(x), fade(y), fade(z)
+
+	p := &n.perm
+	a := p[cubeX] + cubeY
+	aa, ab := p[a]+cubeZ, p[a+1]+cubeZ
+	b := p[cubeX+1] + cubeY
+	ba, bb := p[b]+cubeZ, p[b+1]+cubeZ
+
+	return lerp(w,
+		lerp(v,
+			lerp(u, grad(p[aa], x, y, z), grad(p[ba], x-1, y, z)),
+			lerp(u, grad(p[ab], x, y-1, z), grad(p[bb], x-1, y-1, z))),
+		lerp(v,
+			lerp(u, grad(p[aa+1], x, y, z-1), grad(p[ba+1], x-1, y, z-1)),
+			lerp(u, grad(p[ab+1], x, y-1, z-1), grad(p[bb+1], x-1, y-1, z-1))))
+}
+
+// Fractal adds octaves of noise together, each one twice the frequency and persistence times the strength of the last
+func (n *Noise) Fractal(x, y, z float64, octaves int, persistence float64) float64 {
+	var total, amplitude, maxTotal float64 = 0, 1, 0
+	for i := 0; i < octaves; i++ {
+		total += n.At(x, y, z) * amplitude
+		maxTotal += amplitude
+		amplitude *= persistence
+		x, y, z = x*2, y*2, z*2
+	}
+	return total / maxTotal
+}
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// grad picks one of 12 gradient directions from the hash and dots it with x,y,z
+func grad(hash int, x, y, z float64) float64 {
+	h := hash & 15
+	u := y
+	if h < 8 {
+		u = x
+	}
+	v := z
+	if h < 4 {
+		v = y
+	} else if h == 12 || h == 14 {
+		v = x
+	}
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
@@ -0,0 +1,74 @@
+// Package terrain generates seeded landscapes of stone and dirt hills, caves and lakes. It knows nothing about
+// worlds or cells, the caller decides what each kind of terrain becomes.
+package terrain
+
+import "math"
+
+const ( //the kinds of terrain Generate makes
+	AIR = iota
+	STONE
+	DIRT
+	WATER
+)
+
+// Settings controls what Generate makes
+type Settings struct {
+	Seed        int64
+	SeaLevel    float64 //fraction of the height that lakes fill up to
+	Roughness   float64 //0 gives gentle hills, 1 gives jagged peaks
+	Scale       float64 //rough size of hills in cells
+	DirtDepth   int     //how many cells of dirt sit on top of the stone
+	CaveDensity float64 //0 for no caves, higher carves out more
+}
+
+func DefaultSettings(seed int64) Settings {
+	return Settings{
+		Seed:        seed,
+		SeaLevel:    0.35,
+		Roughness:   0.5,
+		Scale:       32,
+		DirtDepth:   3,
+		CaveDensity: 0.5,
+	}
+}
+
+// Generate calls set with the kind of terrain at every x,y,z of a width by height by depth grid, y is up
+func Generate(width, height, depth int, settings Settings, set func(x, y, z, kind int)) {
+	heightNoise := NewNoise(settings.Seed)
+	caveNoise := NewNoise(settings.Seed + 1)
+
+	octaves := 2 + int(math.Round(settings.Roughness*4))
+	persistence := 0.3 + 0.4*settings.Roughness
+	amplitude := 0.15 + 0.35*settings.Roughness
+	seaLevel := int(settings.SeaLevel * float64(height))
+	caveThreshold := 0.06 * settings.CaveDensity
+
+	for x := 0; x < width; x++ {
+		for z := 0; z < depth; z++ {
+			n := heightNoise.Fractal(float64(x)/settings.Scale, 0.5, float64(z)/settings.Scale, octaves, persistence)
+			surface := int((0.4 + amplitude*n) * float64(height))
+			surface = max(1, min(height, surface))
+
+			for y := 0; y < height; y++ {
+				kind := AIR
+				switch {
+				case y < surface-settings.DirtDepth:
+					kind = STONE
+				case y < surface:
+					kind = DIRT
+				case y < seaLevel:
+					kind = WATER
+				}
+
+				//caves are wormy tunnels along where the noise crosses 0, keep the bottom layer and lake beds solid
+				if y > 0 && y < surface-1 && caveThreshold > 0 {
+					c := caveNoise.Fractal(float64(x)/16, float64(y)/12, float64(z)/16, 2, 0.5)
+					if math.Abs(c) < caveThreshold {
+						kind = AIR
+					}
+				}
+				set(x, y, z, kind)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package terrain
+
+import (
+	"math"
+	"testing"
+)
+
+const testWidth, testHeight, testDepth = 48, 32, 48
+
+// generate makes a grid of terrain kinds indexed by x, y then z
+func generate(settings Settings) [][][]int {
+	grid := make([][][]int, testWidth)
+	for x := range grid {
+		grid[x] = make([][]int, testHeight)
+		for y := range grid[x] {
+			grid[x][y] = make([]int, testDepth)
+		}
+	}
+	Generate(testWidth, testHeight, testDepth, settings, func(x, y, z, kind int) {
+		grid[x][y][z] = kind
+	})
+	return grid
+}
+
+// surfaces gets the height of the top solid cell of each column plus one
+func surfaces(grid [][][]int) []int {
+	var heights []int
+	for x := range grid {
+		for z := range grid[x][0] {
+			top := 0
+			for y := range grid[x] {
+				if kind := grid[x][y][z]; kind == STONE || kind == DIRT {
+					top = y + 1
+				}
+			}
+			heights = append(heights, top)
+		}
+	}
+	return heights
+}
+
+func TestGenerateSeedDeterminism(t *testing.T) {
+	first, again := generate(DefaultSettings(5)), generate(DefaultSettings(5))
+	other := generate(DefaultSettings(6))
+	same, differs := true, false
+	for x := range first {
+		for y := range first[x] {
+			for z := range first[x][y] {
+				same = same && first[x][y][z] == again[x][y][z]
+				differs = differs || first[x][y][z] != other[x][y][z]
+			}
+		}
+	}
+	if !same {
+		t.Errorf("the same seed made different terrain")
+	}
+	if !differs {
+		t.Errorf("different seeds made the same terrain")
+	}
+}
+
+// TestGenerateSeaLevel checks lakes fill every column from its surface up to the sea level and no higher
+func TestGenerateSeaLevel(t *testing.T) {
+	for _, seaLevel := range []float64{0, 0.35, 0.7} {
+		settings := DefaultSettings(3)
+		settings.SeaLevel = seaLevel
+		settings.CaveDensity = 0 //so everything under the surface is solid
+		grid := generate(settings)
+		waterTop := int(seaLevel * testHeight)
+		water := 0
+		for i, surface := range surfaces(grid) {
+			x, z := i/testDepth, i%testDepth
+			for y := surface; y < testHeight; y++ {
+				want := AIR
+				if y < waterTop {
+					want = WATER
+					water++
+				}
+				if got := grid[x][y][z]; got != want {
+					t.Fatalf("sea level %v: %v,%v,%v is %v, want %v", seaLevel, x, y, z, got, want)
+				}
+			}
+		}
+		if seaLevel == 0.7 && water == 0 {
+			t.Errorf("sea level 0.7 didn't flood anything")
+		}
+	}
+}
+
+// TestGenerateRoughness checks rougher terrain varies more in height between neighbouring columns
+func TestGenerateRoughness(t *testing.T) {
+	bumpiness := func(roughness float64) float64 {
+		settings := DefaultSettings(11)
+		settings.Roughness = roughness
+		heights := surfaces(generate(settings))
+		total := 0.0
+		for i := 1; i < len(heights); i++ {
+			if i%testDepth != 0 { //neighbours along z in the same row
+				total += math.Abs(float64(heights[i] - heights[i-1]))
+			}
+		}
+		return total
+	}
+	smooth, rough := bumpiness(0), bumpiness(1)
+	if rough <= smooth {
+		t.Errorf("roughness 1 gave bumpiness %v, not more than roughness 0's %v", rough, smooth)
+	}
+}
+
+func TestNoiseRange(t *testing.T) {
+	n := NewNoise(1)
+	for i := 0; i < 1000; i++ {
+		x, y, z := float64(i)*0.37, float64(i%17)*0.53, float64(i%29)*0.21
+		if v := n.At(x, y, z); v < -1.01 || v > 1.01 {
+			t.Fatalf("noise at %v,%v,%v is %v", x, y, z, v)
+		}
+		if v := n.Fractal(x, y, z, 4, 0.5); v < -1.01 || v > 1.01 {
+			t.Fatalf("fractal noise at %v,%v,%v is %v", x, y, z, v)
+		}
+	}
+	if NewNoise(1).At(1.5, 2.5, 3.5) != n.At(1.5, 2.5, 3.5) {
+		t.Errorf("noise with the same seed differs")
+	}
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"image"
-	"os"
-	"image/png"
+	"image/draw"
+	_ "image/gif" //registers the formats image.Decode can read
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 
 	"github.com/go-gl/gl/v4.6-core/gl"
 )
@@ -14,105 +17,113 @@ const (
 	TEX_DEFAULT_IMAGE_FORMAT = gl.RGBA
 	TEX_DEFAULT_WRAP_S = gl.REPEAT
 	TEX_DEFAULT_WRAP_T = gl.REPEAT
-	TEX_DEFAULT_FILTER_MIN = gl.LINEAR
+	TEX_DEFAULT_FILTER_MIN = gl.LINEAR_MIPMAP_LINEAR
 	TEX_DEFAULT_FILTER_MAX = gl.LINEAR
 )
 
-type Texture struct {
-	ID uint32
-	Width, Height int32
-	InternalFormat int32
-	ImageFormat uint32
-
-	WrapS, WrapT int32
-	FilterMin, FilterMax int32
-}
-
-func NewTexture(texPath string, shader *shader) (*Texture, error) {
-	newTexture := new(Texture)
-	gl.GenTextures(1, &newTexture.ID)
-	newTexture.SetDefaults()
-	
-	width, height, img, err := LoadTextureImg(texPath)
+// LoadTextureImg loads the image called texName as tightly packed 8 bit RGBA ready for GL, so bottom row first.
+// Any PNG, JPEG or GIF works whatever its colour model.
+func LoadTextureImg(assets *AssetLoader, texName string) (int32, int32, []uint8, error) {
+	imgFile, err := assets.Open(texName)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to create texture: %v", err)
+		return 0, 0, nil, fmt.Errorf("failed to open texture %v: %v", texName, err)
 	}
+	defer imgFile.Close()
 
-	newTexture.Width, newTexture.Height = width, height
-	newTexture.Generate(img)
-
-	shader.use()
-	shader.SetInt("texture1", 0)
-	return newTexture, nil
-}
-
-
-func LoadTextureImg(texPath string) (int32, int32, []uint8, error) {
-	imgFile, err := os.Open(texPath)
+	img, err := decodeTextureImg(imgFile)
 	if err != nil {
-		return 0, 0, nil, fmt.Errorf("failed to open file: %v", err)
+		return 0, 0, nil, fmt.Errorf("texture %v: %v", texName, err)
 	}
-	defer imgFile.Close()
+	return int32(img.Rect.Dx()), int32(img.Rect.Dy()), img.Pix, nil
+}
 
-	img, err := png.Decode(imgFile)
+// decodeTextureImg decodes an image and converts it to non premultiplied RGBA, which is what GL expects,
+// flipped so the first row is the bottom one
+func decodeTextureImg(r io.Reader) (*image.NRGBA, error) {
+	img, format, err := image.Decode(r)
 	if err != nil {
-		return 0, 0, nil, fmt.Errorf("failed to decode image: %v", err)
+		return nil, fmt.Errorf("failed to decode image, it should be a PNG, JPEG or GIF: %v", err)
 	}
-	width, height := img.Bounds().Dx(), img.Bounds().Dy()
-	
-	//extract the data
-	// pixelData := ExtractImgData(img, width, height)
-	switch convImg := img.(type) {
-	case *image.RGBA:
-		return int32(width), int32(height), convImg.Pix, nil
-	case *image.NRGBA:
-		return int32(width), int32(height), convImg.Pix, nil
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, fmt.Errorf("the %v image is empty", format)
 	}
-	//flipImage(img.(*image.RGBA))
-	return int32(width), int32(height), img.(*image.RGBA).Pix, nil
-	
-}
 
-// SetDefaults sets the teextures fields to be the defualt values
-func (t *Texture) SetDefaults()  {
-	t.InternalFormat = TEX_DEFAULT_INTERAL_FORMAT
-	t.ImageFormat = TEX_DEFAULT_IMAGE_FORMAT
-	t.WrapS = TEX_DEFAULT_WRAP_S
-	t.WrapT = TEX_DEFAULT_WRAP_T
-	t.FilterMin = TEX_DEFAULT_FILTER_MIN
-	t.FilterMax = TEX_DEFAULT_FILTER_MAX
+	//drawing into a fresh image converts from any colour model and leaves no gaps between rows
+	converted := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(converted, converted.Rect, img, bounds.Min, draw.Src)
+	flipImage(converted)
+	return converted, nil
 }
 
-// Generate generates the texture data
-func (t *Texture) Generate(data []uint8)  {
-	// make the texture
-	gl.BindTexture(gl.TEXTURE_2D, t.ID)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, t.InternalFormat, t.Width, t.Height, 0, t.ImageFormat, gl.UNSIGNED_BYTE, gl.Ptr(data))
-
-	//set the texture wrap and filter stuff
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, t.WrapS)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, t.WrapT)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, t.FilterMin)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, t.FilterMax)
+// flipImage turns img upside down, since GL puts the first row of a texture at the bottom
+func flipImage(img *image.NRGBA) {
+	flipRows(img.Pix, img.Stride, img.Rect.Dx()*4, img.Rect.Dy())
+}
 
-	//unbind the texture
-	// gl.GenerateMipmap(gl.TEXTURE_2D)
-	gl.BindTexture(gl.TEXTURE_2D, 0)
+// flipRows swaps height rows of rowBytes each, stride apart in pix, top to bottom
+func flipRows(pix []uint8, stride, rowBytes, height int) {
+	tmp := make([]uint8, rowBytes)
+	for y := 0; y < height/2; y++ {
+		top := pix[y*stride : y*stride+rowBytes]
+		bottom := pix[(height-1-y)*stride : (height-1-y)*stride+rowBytes]
+		copy(tmp, top)
+		copy(top, bottom)
+		copy(bottom, tmp)
+	}
 }
 
-// Bind binds the texture
-func (t *Texture) Bind(texUnit uint32)  {
-	gl.ActiveTexture(texUnit)
-	gl.BindTexture(gl.TEXTURE_2D, t.ID)
+// TextureArray is a stack of same sized textures in one GL_TEXTURE_2D_ARRAY, shaders pick a layer per cell
+type TextureArray struct {
+	ID            uint32
+	Width, Height int32
+	Layers        int32
 }
 
-func flipImage(img *image.RGBA) {
-	width, height := img.Bounds().Size().X, img.Bounds().Size().Y
-	for y := 0; y < height/2; y++ {
-		for x := 0; x < width; x++ {
-			tmp := img.RGBAAt(x, y)
-			img.SetRGBA(x, y, img.RGBAAt(x, height-1-y))
-			img.SetRGBA(x, height-1-y, tmp)
+// NewTextureArray loads the images called names into the layers of a texture array, in order
+func NewTextureArray(assets *AssetLoader, names []string) (*TextureArray, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("a texture array needs at least one texture")
+	}
+	images := make([][]uint8, len(names))
+	t := &TextureArray{Layers: int32(len(names))}
+	for i, name := range names {
+		width, height, img, err := LoadTextureImg(assets, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load texture %v: %v", name, err)
+		}
+		if i == 0 {
+			t.Width, t.Height = width, height
+		} else if width != t.Width || height != t.Height {
+			return nil, fmt.Errorf("texture %v is %vx%v but %v is %vx%v, they all have to be the same size",
+				name, width, height, names[0], t.Width, t.Height)
 		}
+		images[i] = img
 	}
+
+	gl.GenTextures(1, &t.ID)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, t.ID)
+	gl.TexImage3D(gl.TEXTURE_2D_ARRAY, 0, TEX_DEFAULT_INTERAL_FORMAT, t.Width, t.Height, t.Layers, 0,
+		TEX_DEFAULT_IMAGE_FORMAT, gl.UNSIGNED_BYTE, nil)
+	for layer, img := range images {
+		gl.TexSubImage3D(gl.TEXTURE_2D_ARRAY, 0, 0, 0, int32(layer), t.Width, t.Height, 1,
+			TEX_DEFAULT_IMAGE_FORMAT, gl.UNSIGNED_BYTE, gl.Ptr(img))
+	}
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_S, TEX_DEFAULT_WRAP_S)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_T, TEX_DEFAULT_WRAP_T)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MIN_FILTER, TEX_DEFAULT_FILTER_MIN)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MAG_FILTER, TEX_DEFAULT_FILTER_MAX)
+	gl.GenerateMipmap(gl.TEXTURE_2D_ARRAY)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, 0)
+	return t, nil
+}
+
+// Bind binds the texture array to texture unit unit, counting from 0
+func (t *TextureArray) Bind(unit uint32) {
+	gl.ActiveTexture(gl.TEXTURE0 + unit)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, t.ID)
+}
+
+func (t *TextureArray) Delete() {
+	gl.DeleteTextures(1, &t.ID)
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// testTextureImages makes a 3x2 image in each colour model artists' exports tend to use, with a white top left
+// pixel and black everywhere else
+func testTextureImages() map[string]image.Image {
+	rect := image.Rect(0, 0, 3, 2)
+	images := map[string]image.Image{
+		"rgba":     image.NewRGBA(rect),
+		"nrgba":    image.NewNRGBA(rect),
+		"gray":     image.NewGray(rect),
+		"gray16":   image.NewGray16(rect),
+		"rgba64":   image.NewRGBA64(rect),
+		"paletted": image.NewPaletted(rect, palette.Plan9),
+	}
+	for _, img := range images {
+		drawable := img.(interface{ Set(x, y int, c color.Color) })
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 3; x++ {
+				drawable.Set(x, y, color.Black)
+			}
+		}
+		drawable.Set(0, 0, color.White)
+	}
+	return images
+}
+
+func TestDecodeTextureImg(t *testing.T) {
+	encoders := map[string]func(img image.Image) ([]byte, error){
+		"png": func(img image.Image) ([]byte, error) {
+			var buf bytes.Buffer
+			err := png.Encode(&buf, img)
+			return buf.Bytes(), err
+		},
+		"jpeg": func(img image.Image) ([]byte, error) {
+			var buf bytes.Buffer
+			err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100})
+			return buf.Bytes(), err
+		},
+		"gif": func(img image.Image) ([]byte, error) {
+			var buf bytes.Buffer
+			err := gif.Encode(&buf, img, nil)
+			return buf.Bytes(), err
+		},
+	}
+
+	for format, encode := range encoders {
+		for model, img := range testTextureImages() {
+			data, err := encode(img)
+			if err != nil {
+				t.Fatalf("encoding %v %v: %v", model, format, err)
+			}
+			decoded, err := decodeTextureImg(bytes.NewReader(data))
+			if err != nil {
+				t.Errorf("%v %v: %v", model, format, err)
+				continue
+			}
+			if decoded.Rect.Dx() != 3 || decoded.Rect.Dy() != 2 || len(decoded.Pix) != 3*2*4 {
+				t.Errorf("%v %v decoded to %v with %v bytes", model, format, decoded.Rect, len(decoded.Pix))
+				continue
+			}
+			//the white pixel was in the top row so it should be in the last one now, jpeg blurs it a bit
+			white, black := decoded.Pix[3*4], decoded.Pix[0]
+			if white < 200 || black > 55 || decoded.Pix[3*4+3] != 255 {
+				t.Errorf("%v %v isn't flipped right: %v", model, format, decoded.Pix)
+			}
+		}
+	}
+}
+
+func TestDecodeTextureImgErrors(t *testing.T) {
+	_, err := decodeTextureImg(strings.NewReader("not an image"))
+	if err == nil || !strings.Contains(err.Error(), "PNG, JPEG or GIF") {
+		t.Errorf("expected an error naming the supported formats, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+	if _, err := decodeTextureImg(bytes.NewReader(buf.Bytes()[:buf.Len()/2])); err == nil {
+		t.Errorf("expected an error decoding half a png")
+	}
+}
+
+func TestFlipImage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 3))
+	for y := 0; y < 3; y++ {
+		img.Pix[y*img.Stride] = uint8(y)
+	}
+	flipImage(img)
+	for y, want := range []uint8{2, 1, 0} {
+		if got := img.Pix[y*img.Stride]; got != want {
+			t.Errorf("row %v has %v, want %v", y, got, want)
+		}
+	}
+}
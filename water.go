@@ -0,0 +1,148 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/go-gl/gl/v4.6-core/gl"
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+// Water is drawn after everything else as one see through mesh. Only the faces of water cells that open onto air
+// or the edge of the world are in it, so a lake looks like a single volume instead of a stack of boxes.
+// Each vertex also carries how deep the water is there, which tints it darker, and whether it's on the surface,
+// which the shaders ripple with waves.
+
+const FACE_VERTICES = 6                         //two triangles per face
+const WATER_VERTEX_STRIDE = VERTEX_STRIDE + 2   //a cube vertex then the water depth and whether it's on the surface
+const WATER_WAVE_HEIGHT = 0.06                  //how far waves dip the water's surface, as a fraction of a cell
+const WATER_REFRACTION_STRENGTH float32 = 0.015 //how far the waves bend what's seen through the water, in screen space
+
+// waterFace is a face of a water cell that can be seen
+type waterFace struct {
+	X, Y, Z, Face int
+	distance      float32 //squared distance from the camera to the middle of the face
+}
+
+// waterFaceVisible gets whether face of the water cell at x,y,z opens onto air or the edge of the world
+func (w *World) waterFaceVisible(x, y, z, face int) bool {
+	normal := faceNormals[face]
+	nx, ny, nz := x+normal[0], y+normal[1], z+normal[2]
+	return !w.IndexInRange(nx, ny, nz) || w.Cells[nx][ny][nz].Type == AIR
+}
+
+// waterFaces gets every visible water face, sorted furthest from cameraPos first so they blend in the right order
+func (w *World) waterFaces(cameraPos glm.Vec3) []waterFace {
+	var faces []waterFace
+	halfCell := w.CellSize() / 2
+	for x := range w.Cells {
+		for y := range w.Cells[x] {
+			for z := range w.Cells[x][y] {
+				if w.Cells[x][y][z].Type != WATER {
+					continue
+				}
+				for face, normal := range faceNormals {
+					if !w.waterFaceVisible(x, y, z, face) {
+						continue
+					}
+					middle := w.CellPosition(x, y, z).Add(glm.Vec3{float32(normal[0]), float32(normal[1]), float32(normal[2])}.Mul(halfCell))
+					offset := middle.Sub(cameraPos)
+					faces = append(faces, waterFace{x, y, z, face, offset.Dot(offset)})
+				}
+			}
+		}
+	}
+	sort.Slice(faces, func(i, j int) bool { return faces[i].distance > faces[j].distance })
+	return faces
+}
+
+// waterColumnDepth gets how many water cells are stacked up in the unbroken run of water the cell at x,y,z is in
+func (w *World) waterColumnDepth(x, y, z int) int {
+	depth := 1
+	for above := y + 1; above < w.Height && w.Cells[x][above][z].Type == WATER; above++ {
+		depth++
+	}
+	for below := y - 1; below >= 0 && w.Cells[x][below][z].Type == WATER; below-- {
+		depth++
+	}
+	return depth
+}
+
+// waterSurface gets whether the water cell at x,y,z has air or the top of the world above it
+func (w *World) waterSurface(x, y, z int) bool {
+	return y+1 >= w.Height || w.Cells[x][y+1][z].Type == AIR
+}
+
+// WaterMesh builds the water's visible faces into mesh in world space, furthest from cameraPos first.
+// The vertices are laid out like the vertices array followed by the water's depth in cells and 1 for the vertices
+// along the top of a surface cell or 0 otherwise. mesh is reused to save allocating every frame.
+func (w *World) WaterMesh(cameraPos glm.Vec3, mesh []float32) []float32 {
+	mesh = mesh[:0]
+	cellSize := w.CellSize()
+	for _, face := range w.waterFaces(cameraPos) {
+		centre := w.CellPosition(face.X, face.Y, face.Z)
+		depth := float32(w.waterColumnDepth(face.X, face.Y, face.Z))
+		surface := w.waterSurface(face.X, face.Y, face.Z)
+		faceVertices := vertices[face.Face*FACE_VERTICES*VERTEX_STRIDE : (face.Face+1)*FACE_VERTICES*VERTEX_STRIDE]
+		for i := 0; i < len(faceVertices); i += VERTEX_STRIDE {
+			vertex := faceVertices[i : i+VERTEX_STRIDE]
+			for axis := 0; axis < 3; axis++ {
+				mesh = append(mesh, centre[axis]+vertex[axis]*cellSize)
+			}
+			mesh = append(mesh, vertex[3:]...) //texture coords and normal don't change
+			onSurface := float32(0)
+			if surface && vertex[1] > 0 {
+				onSurface = 1
+			}
+			mesh = append(mesh, depth, onSurface)
+		}
+	}
+	return mesh
+}
+
+// SetWaterUniforms sets the uniforms the water's waves and tint need on s, which has to be in use.
+// seconds drives the waves, refraction is nil when it's turned off.
+func SetWaterUniforms(s *shader, seconds, cellSize float32, refraction *WaterRefraction) {
+	s.SetFloat("Time", seconds)
+	s.SetFloat("CellSize", cellSize)
+	s.SetFloat("WaveHeight", WATER_WAVE_HEIGHT)
+	if refraction != nil {
+		s.SetInt("SceneColour", WATER_SCENE_TEXTURE_UNIT)
+		s.SetVec2f("ScreenSize", float32(refraction.width), float32(refraction.height))
+		s.SetFloat("RefractionStrength", WATER_REFRACTION_STRENGTH)
+	}
+}
+
+// ------------------------------ Refraction ------------------------------
+
+const WATER_SCENE_TEXTURE_UNIT = 1
+
+// WaterRefraction holds a copy of the screen from before the water is drawn, so what's behind the water can be
+// drawn again bent by the waves before the water blends over it
+type WaterRefraction struct {
+	texture       uint32
+	width, height int32
+}
+
+func NewWaterRefraction(width, height int32) *WaterRefraction {
+	r := &WaterRefraction{width: width, height: height}
+	gl.GenTextures(1, &r.texture)
+	gl.BindTexture(gl.TEXTURE_2D, r.texture)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, width, height, 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	return r
+}
+
+// Capture copies what's been drawn so far and binds it for the water to sample
+func (r *WaterRefraction) Capture() {
+	gl.ActiveTexture(gl.TEXTURE0 + WATER_SCENE_TEXTURE_UNIT)
+	gl.BindTexture(gl.TEXTURE_2D, r.texture)
+	gl.CopyTexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 0, 0, r.width, r.height)
+	gl.ActiveTexture(gl.TEXTURE0)
+}
+
+func (r *WaterRefraction) Delete() {
+	gl.DeleteTextures(1, &r.texture)
+}
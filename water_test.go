@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	glm "github.com/go-gl/mathgl/mgl32"
+)
+
+func TestWaterFacesCullInterior(t *testing.T) {
+	w := MakeWorld(4, 4, 4)
+	w.Cells[1][1][1] = Cell{Type: WATER}
+	w.Cells[2][1][1] = Cell{Type: WATER}
+	w.Cells[1][0][1] = Cell{Type: DIRT} //under the first water cell
+
+	faces := w.waterFaces(glm.Vec3{0, 10, 0})
+	//12 faces between them, minus the two they share and the one on the dirt
+	if len(faces) != 9 {
+		t.Fatalf("got %v water faces, want 9: %v", len(faces), faces)
+	}
+	for _, face := range faces {
+		if (face.X == 1 && face.Face == 3) || (face.X == 2 && face.Face == 2) {
+			t.Errorf("the face between the two water cells shouldn't be drawn: %+v", face)
+		}
+		if face.X == 1 && face.Face == 4 {
+			t.Errorf("the face on the dirt shouldn't be drawn: %+v", face)
+		}
+	}
+
+	w.Cells[0][0][0] = Cell{Type: WATER} //in the corner, three faces are on the edge of the world
+	if got := len(w.waterFaces(glm.Vec3{})); got != 15 {
+		t.Errorf("got %v water faces with one in the corner, want 15", got)
+	}
+}
+
+func TestWaterFacesBackToFront(t *testing.T) {
+	w := MakeWorld(8, 1, 1)
+	for x := 0; x < w.Width; x++ {
+		w.Cells[x][0][0] = Cell{Type: WATER}
+	}
+	camera := glm.Vec3{100, 0, 0}
+	faces := w.waterFaces(camera)
+	for i := 1; i < len(faces); i++ {
+		if faces[i].distance > faces[i-1].distance {
+			t.Fatalf("face %v is further away than the one before it", i)
+		}
+	}
+	if first := faces[0]; first.X != 0 || first.Face != 2 {
+		t.Errorf("the furthest face should be the low x end, got %+v", first)
+	}
+}
+
+func TestWaterMesh(t *testing.T) {
+	w := MakeWorld(2, 2, 2)
+	w.Cells[1][1][1] = Cell{Type: WATER}
+	mesh := w.WaterMesh(glm.Vec3{0, 10, 0}, nil)
+	if want := 6 * FACE_VERTICES * WATER_VERTEX_STRIDE; len(mesh) != want {
+		t.Fatalf("got %v floats for a lone water cell, want %v", len(mesh), want)
+	}
+
+	//every vertex should be on the cell's corners, the top ones on the surface
+	centre, half := w.CellPosition(1, 1, 1), w.CellSize()/2
+	for i := 0; i < len(mesh); i += WATER_VERTEX_STRIDE {
+		for axis := 0; axis < 3; axis++ {
+			offset := mesh[i+axis] - centre[axis]
+			if !glm.FloatEqual(offset, half) && !glm.FloatEqual(offset, -half) {
+				t.Fatalf("vertex %v is off the cell's corners: %v", i/WATER_VERTEX_STRIDE, mesh[i:i+3])
+			}
+		}
+		depth, surface := mesh[i+VERTEX_STRIDE], mesh[i+VERTEX_STRIDE+1]
+		if depth != 1 {
+			t.Errorf("vertex %v has depth %v, want 1", i/WATER_VERTEX_STRIDE, depth)
+		}
+		if onTop := mesh[i+1] > centre.Y(); (surface == 1) != onTop {
+			t.Errorf("vertex %v at %v has surface %v", i/WATER_VERTEX_STRIDE, mesh[i:i+3], surface)
+		}
+	}
+
+	if reused := w.WaterMesh(glm.Vec3{}, mesh); &reused[0] != &mesh[0] {
+		t.Errorf("the mesh should be rebuilt in place")
+	}
+}
+
+func TestWaterColumnDepth(t *testing.T) {
+	w := MakeWorld(1, 6, 1)
+	for y, cellType := range []int{WATER, WATER, DIRT, WATER, WATER, WATER} {
+		w.Cells[0][y][0] = Cell{Type: cellType}
+	}
+	for y, want := range []int{2, 2, 0, 3, 3, 3} {
+		if want == 0 {
+			continue
+		}
+		if got := w.waterColumnDepth(0, y, 0); got != want {
+			t.Errorf("water at y %v is in a column %v deep, want %v", y, got, want)
+		}
+	}
+	if w.waterSurface(0, 1, 0) {
+		t.Errorf("water under dirt shouldn't be the surface")
+	}
+	if !w.waterSurface(0, 5, 0) {
+		t.Errorf("water at the top of the world should be the surface")
+	}
+}
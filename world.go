@@ -1,23 +1,64 @@
 package main
 
 import (
-	// "fmt"
+	"fmt"
 	"math/rand"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/gl/v4.6-core/gl"
+	glm "github.com/go-gl/mathgl/mgl32"
 )
 
+const MAX_WORLD_SIZE = 1024     //the most cells along any side of the world
+const MAX_WORLD_CELLS = 1 << 24 //the most cells in the whole world, as many as 256x256x256
+
 type World struct {
 	Cells                [][][]Cell
 	Visited              [][][]bool
 	Width, Height, Depth int
+	History              EditHistory
+	Seed                 int64
+	Rand                 *rand.Rand //all randomness in the sim comes from here so runs can be replayed
+	Tick                 int        //how many updates have been run
+	Recorder             *ReplayRecorder
+	Checker              *InvariantChecker //checks each update for lost or duplicated cells when not nil
+	ScanOrder            int               //the order Update visits cells in, one of the SCAN_ constants
+	UpdateMode           int               //which rules Update moves cells with, one of the UPDATE_ constants
+	GPU                  *GPUSim           //runs the block rules on the GPU when not nil, Cells is only synced when needed
+
+	xOrder, zOrder []int
+	readCells      [][][]Cell //the grid at the start of the tick when double buffering, nil otherwise
+	readBuffer     [][][]Cell
 }
 
 func MakeWorld(width, height, depth int) *World {
 	newWorld := new(World) //I hate my job
 	newWorld.ResetCellGrid(width, height, depth)
 	newWorld.Width, newWorld.Height, newWorld.Depth = width, height, depth
+	newWorld.History.MaxBytes = HISTORY_BUDGET
+	newWorld.SetSeed(1)
+	newWorld.ScanOrder = SCAN_ALTERNATE
 	return newWorld
 }
 
+// checkWorldSize checks a world of width by height by depth cells has some cells and isn't too big to make
+func checkWorldSize(width, height, depth int) error {
+	if width <= 0 || height <= 0 || depth <= 0 {
+		return fmt.Errorf("invalid world size %vx%vx%v", width, height, depth)
+	}
+	if width > MAX_WORLD_SIZE || height > MAX_WORLD_SIZE || depth > MAX_WORLD_SIZE || width*height*depth > MAX_WORLD_CELLS {
+		return fmt.Errorf("world size %vx%vx%v is too big, it can be up to %v cells along a side and %v in all",
+			width, height, depth, MAX_WORLD_SIZE, MAX_WORLD_CELLS)
+	}
+	return nil
+}
+
+// SetSeed resets the world's random number generator with seed
+func (w *World) SetSeed(seed int64) {
+	w.Seed = seed
+	w.Rand = rand.New(rand.NewSource(seed))
+}
+
 // ResetCellGrid reset the cell grid and the visited grid
 func (w *World) ResetCellGrid(width, height, depth int) {
 	var cubeGrid = make([][][]Cell, width)
@@ -49,52 +90,183 @@ func (w *World) ResetVisitedGrid(width, height, depth int) {
 	w.Visited = visitedGrid
 }
 
+// CellSize gets the size cells are drawn at, the longest side of the world is drawn 1 unit long
+func (w *World) CellSize() float32 {
+	return 1.0 / float32(max(w.Width, w.Height, w.Depth))
+}
+
+// Extents gets the size of the whole world when drawn, it's centred on the origin
+func (w *World) Extents() glm.Vec3 {
+	cellSize := w.CellSize()
+	return glm.Vec3{float32(w.Width) * cellSize, float32(w.Height) * cellSize, float32(w.Depth) * cellSize}
+}
+
+// CellPosition gets the centre of the cell at x,y,z when drawn
+func (w *World) CellPosition(x, y, z int) glm.Vec3 {
+	cellSize := w.CellSize()
+	start := w.Extents().Mul(-0.5).Add(glm.Vec3{0.5 * cellSize, 0.5 * cellSize, 0.5 * cellSize})
+	return start.Add(glm.Vec3{float32(x), float32(y), float32(z)}.Mul(cellSize))
+}
+
 // Draw draw the world
 func (w *World) Draw(shader *shader)  {
-	var startX, startY, startZ float32
-	startX = -0.5 + 0.5*CELL_SIZE_SCALAR
-	startY = -0.5 + 0.5*CELL_SIZE_SCALAR
-	startZ = -0.5 + 0.5*CELL_SIZE_SCALAR
-	
+	cellSize := w.CellSize()
 	for x := 0; x < w.Width; x++ {
 		for y := 0; y < w.Height; y++ {
 			for z := 0; z < w.Depth; z++ {
-				posX := startX + float32(x) * CELL_SIZE_SCALAR
-				posY := startY + float32(y) * CELL_SIZE_SCALAR
-				posZ := startZ + float32(z) * CELL_SIZE_SCALAR
-				w.Cells[x][y][z].Draw(posX, posY, posZ, shader)
+				if cellType := w.Cells[x][y][z].Type; cellType == AIR || cellType == WATER { //water goes in WaterMesh
+					continue
+				}
+				ao := w.CellAO(x, y, z)
+				shader.SetUVec2("AO", ao[0], ao[1])
+				pos := w.CellPosition(x, y, z)
+				w.Cells[x][y][z].Draw(pos.X(), pos.Y(), pos.Z(), cellSize, shader)
 			}
 		}
 	}
 }
 
+// DrawDepth draws just the shape of the world's solid cells, for passes like the shadow map that only need depth.
+// It only sets the model matrix, skipping the materials and occlusion Draw works out for every cell.
+func (w *World) DrawDepth(shader *shader) {
+	cellSize := w.CellSize()
+	scale := glm.Scale3D(cellSize, cellSize, cellSize)
+	for x := 0; x < w.Width; x++ {
+		for y := 0; y < w.Height; y++ {
+			for z := 0; z < w.Depth; z++ {
+				if cellType := w.Cells[x][y][z].Type; cellType == AIR || cellType == WATER {
+					continue
+				}
+				pos := w.CellPosition(x, y, z)
+				model := glm.Translate3D(pos.X(), pos.Y(), pos.Z()).Mul4(scale)
+				shader.SetMat4("model", &model)
+				gl.DrawArrays(gl.TRIANGLES, 0, 36)
+			}
+		}
+	}
+}
 
-// GetCameraCell gets the cell that the camera is looking at
-func (w *World) GetCameraCell(c *Camera)  {
-	gridX := int(c.Position.X() / CELL_SIZE_SCALAR)
-	gridZ := int(c.Position.Z() / CELL_SIZE_SCALAR)
+// FrameCamera moves the camera back far enough to see the whole world, looking down the z axis
+func (w *World) FrameCamera(c *Camera) {
+	radius := w.Extents().Len() / 2
+	distance := radius / math32.Sin(glm.DegToRad(c.Zoom)/2)
+	c.Position = glm.Vec3{0, 0, distance}
+	c.Yaw, c.Pitch = INIT_YAW, INIT_PITCH
+	c.updateCameraVectors()
+}
 
+// GetCameraCell gets the cell that the camera is looking at on the selectionY layer,
+// ok is false if the camera isn't looking towards the layer
+func (w *World) GetCameraCell(c *Camera) (gridX, gridY, gridZ int, ok bool) {
 	viewDir := c.Front.Normalize()
+	if viewDir.Y() == 0 {
+		return 0, 0, 0, false
+	}
 
-	t := (selectionY - c.Position.Y()) / viewDir.Y()
+	//the world is drawn centred on the origin so shift by half of it to get grid coords
+	cellSize := w.CellSize()
+	halfExtents := w.Extents().Mul(0.5)
+	planeY := -halfExtents.Y() + (selectionY+0.5)*cellSize
+	t := (planeY - c.Position.Y()) / viewDir.Y()
+	if t < 0 {
+		return 0, 0, 0, false
+	}
 
 	intersectPoint := c.Position.Add(viewDir.Mul(t))
 
-	gridX = int(intersectPoint.X() / CELL_SIZE_SCALAR)
-	gridZ = int(intersectPoint.Z() / CELL_SIZE_SCALAR)
+	gridX = int(math32.Floor((intersectPoint.X() + halfExtents.X()) / cellSize))
+	gridZ = int(math32.Floor((intersectPoint.Z() + halfExtents.Z()) / cellSize))
 
-	gridX = max(0, min(WORLD_SIZE-1, gridX))
-	gridZ = max(0, min(WORLD_SIZE-1, gridZ))
+	gridX = max(0, min(w.Width-1, gridX))
+	gridY = max(0, min(w.Height-1, int(selectionY)))
+	gridZ = max(0, min(w.Depth-1, gridZ))
 
-	// fmt.Println(gridX, gridZ)
+	return gridX, gridY, gridZ, true
 }
 
 // ------------------------------ Adding Things ------------------------------
 // AddCell Adds a cell of cellType to point at x,y,z
 func (w *World) AddCell(x, y, z, cellType int)  {
 	if w.IndexInRange(x, y, z) {
-		w.Cells[x][y][z] = Cell{Type: cellType}
+		w.setCell(x, y, z, Cell{Type: cellType})
+	}
+}
+
+// AddSource adds a source at x,y,z that spawns emitType cells at rate cells per tick
+func (w *World) AddSource(x, y, z, emitType int, rate float32) {
+	if w.IndexInRange(x, y, z) {
+		w.setCell(x, y, z, Cell{Type: SOURCE, Emit: emitType, Rate: rate})
+	}
+}
+
+// FillBox fills every cell between the two corners with cellType, as one edit
+func (w *World) FillBox(x1, y1, z1, x2, y2, z2, cellType int) {
+	w.BeginEdit()
+	defer w.EndEdit()
+	for x := max(min(x1, x2), 0); x <= min(max(x1, x2), w.Width-1); x++ {
+		for y := max(min(y1, y2), 0); y <= min(max(y1, y2), w.Height-1); y++ {
+			for z := max(min(z1, z2), 0); z <= min(max(z1, z2), w.Depth-1); z++ {
+				w.AddCell(x, y, z, cellType)
+			}
+		}
+	}
+}
+
+// FillSphere fills every cell whose centre is within radius of the centre cell with cellType, as one edit
+func (w *World) FillSphere(centreX, centreY, centreZ int, radius float32, cellType int) {
+	w.BeginEdit()
+	defer w.EndEdit()
+	reach := int(math32.Ceil(radius))
+	for x := centreX - reach; x <= centreX+reach; x++ {
+		for y := centreY - reach; y <= centreY+reach; y++ {
+			for z := centreZ - reach; z <= centreZ+reach; z++ {
+				dx, dy, dz := float32(x-centreX), float32(y-centreY), float32(z-centreZ)
+				if dx*dx+dy*dy+dz*dz <= radius*radius {
+					w.AddCell(x, y, z, cellType)
+				}
+			}
+		}
+	}
+}
+
+// FillLine fills the cells along the line between the two points with cellType, as one edit
+func (w *World) FillLine(x1, y1, z1, x2, y2, z2, cellType int) {
+	w.BeginEdit()
+	defer w.EndEdit()
+	steps := max(abs(x2-x1), abs(y2-y1), abs(z2-z1))
+	for i := 0; i <= steps; i++ {
+		t := float32(0)
+		if steps > 0 {
+			t = float32(i) / float32(steps)
+		}
+		x := x1 + int(math32.Round(t*float32(x2-x1)))
+		y := y1 + int(math32.Round(t*float32(y2-y1)))
+		z := z1 + int(math32.Round(t*float32(z2-z1)))
+		w.AddCell(x, y, z, cellType)
+	}
+}
+
+// CountCells counts how many cells of cellType are in the world
+func (w *World) CountCells(cellType int) int {
+	w.pullGPU()
+	count := 0
+	for x := range w.Cells {
+		for y := range w.Cells[x] {
+			for z := range w.Cells[x][y] {
+				if w.Cells[x][y][z].Type == cellType {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
 	}
+	return n
 }
 
 // ------------------------------ Stuff for Updating ------------------------------
@@ -102,16 +274,32 @@ func (w *World) AddCell(x, y, z, cellType int)  {
 // Update updates the world
 func (w *World) Update() {
 	//maybe add stuff for like only updating sections so I can maybe goroutine it
+	if w.GPU != nil {
+		if w.UpdateMode == UPDATE_BLOCK {
+			w.GPU.Step(w)
+			w.Tick++
+			return
+		}
+		w.pullGPU() //the other modes only run on the CPU
+		defer w.pushGPU()
+	}
 	w.ResetVisitedGrid(w.Width, w.Height, w.Depth)
-	for x := 0; x < w.Width; x++ {
-		for y := 0; y < w.Height; y++ {
-			for z := 0; z < w.Depth; z++ {
-				if !w.Visited[x][y][z] {
-					w.MoveCell(x, y, z)
-				}
+	if w.Checker != nil {
+		w.Checker.beginTick(w)
+	}
+	if w.UpdateMode == UPDATE_BLOCK {
+		w.updateBlocks()
+	} else {
+		w.scanCells(func(x, y, z int) {
+			if !w.Visited[x][y][z] {
+				w.MoveCell(x, y, z)
 			}
-		}
+		})
+	}
+	if w.Checker != nil {
+		w.Checker.endTick(w)
 	}
+	w.Tick++
 }
 
 // MoveCell attempts to move the cell
@@ -122,12 +310,29 @@ func (w *World) MoveCell(x, y, z int) {
 		w.moveCellDirt(x, y, z)
 	case WATER:
 		w.moveCellWater(x, y, z)
+	case SOURCE:
+		w.updateSource(x, y, z)
+	}
+}
+
+// updateSource spawns the source's Emit type into the cell below it once it has built up enough charge
+func (w *World) updateSource(x, y, z int) {
+	source := &w.Cells[x][y][z]
+	source.Charge = min(source.Charge+source.Rate, 1) //don't let it build up while blocked
+
+	if source.Charge >= 1 && w.IndexInRange(x, y-1, z) && w.Cells[x][y-1][z].Type == AIR {
+		w.Cells[x][y-1][z] = Cell{Type: source.Emit}
+		w.Visited[x][y-1][z] = true
+		if w.Checker != nil {
+			w.Checker.spawn(source.Emit)
+		}
+		source.Charge -= 1
 	}
 }
 
 // moveCellDirt moves cells for dirt type
 func (w *World) moveCellDirt(x, y, z int)  {
-	if w.IndexInRange(x, y-1, z) && w.Cells[x][y-1][z].Type == AIR {
+	if w.checkMove(x, y-1, z, AIR) {
 		w.SwapCells(x, y, z, x, y-1, z)
 		w.Visited[x][y-1][z] = true
 	} else {
@@ -149,7 +354,7 @@ func (w *World) moveCellDirt(x, y, z int)  {
 		}
 		
 		for !optionRan {
-			choice := rand.Int31n(8)
+			choice := w.Rand.Int31n(8)
 			switch {
 			case move1 && choice == 0:
 				w.SwapCells(x, y, z, x-1, y-1, z)
@@ -181,13 +386,24 @@ func (w *World) moveCellDirt(x, y, z int)  {
 }
 
 // checkMove check if the movement is correct
+// sinks count as air since anything moving into them just gets deleted,
+// when double buffering the cell has to have been free at the start of the tick too
 func (w *World) checkMove(x, y, z, moveType int) bool {
-	return w.IndexInRange(x, y, z) && w.Cells[x][y][z].Type == moveType
+	if !w.IndexInRange(x, y, z) {
+		return false
+	}
+	matches := func(cellType int) bool {
+		return cellType == moveType || (moveType == AIR && cellType == SINK)
+	}
+	if w.readCells != nil && !matches(w.readCells[x][y][z].Type) {
+		return false
+	}
+	return matches(w.Cells[x][y][z].Type)
 }
 
 // moveCellWater move cell for the water type
 func (w *World) moveCellWater(x, y, z int)  {
-	if w.IndexInRange(x, y-1, z) && w.Cells[x][y-1][z].Type == AIR {
+	if w.checkMove(x, y-1, z, AIR) {
 		w.SwapCells(x, y, z, x, y-1, z)
 		w.Visited[x][y-1][z] = true
 	} else {
@@ -207,7 +423,7 @@ func (w *World) moveCellWater(x, y, z int)  {
 		}
 		
 		for !optionRan {
-			choice := rand.Int31n(8)
+			choice := w.Rand.Int31n(8)
 			switch {
 			case move1 && choice == 0:
 				w.SwapCells(x, y, z, x-1, y, z)
@@ -238,8 +454,20 @@ func (w *World) moveCellWater(x, y, z int)  {
 	}
 }
 
-// SwapCells swaps two cells with each other
+// SwapCells swaps two cells with each other, if the second cell is a sink then the first cell is drained instead
 func (w *World) SwapCells(x1, y1, z1, x2, y2, z2 int)  {
+	if w.Cells[x2][y2][z2].Type == SINK {
+		if w.Checker != nil {
+			w.Checker.drain(w, x1, y1, z1)
+		}
+		w.Cells[x1][y1][z1] = Cell{Type: AIR}
+		w.Visited[x1][y1][z1] = true
+		w.Visited[x2][y2][z2] = true
+		return
+	}
+	if w.Checker != nil {
+		w.Checker.swap(w, x1, y1, z1, x2, y2, z2)
+	}
 	cell2 := w.Cells[x2][y2][z2]
 	w.Cells[x2][y2][z2] = w.Cells[x1][y1][z1]
 	w.Cells[x1][y1][z1] = cell2
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden grids in testdata/golden from the current rules")
+
+// TestGolden runs every testdata/golden/*.in grid and compares the result with its .golden grid
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "golden", "*.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden inputs found")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".in")
+		t.Run(name, func(t *testing.T) {
+			text, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, ticks, err := parseGrid(string(text))
+			if err != nil {
+				t.Fatalf("%v: %v", input, err)
+			}
+			w.EnableInvariantChecks()
+			for i := 0; i < ticks; i++ {
+				w.Update()
+				if err := w.Checker.Err(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := formatGrid(w)
+
+			goldenPath := strings.TrimSuffix(input, ".in") + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%v, run with -update to make it", err)
+			}
+			if got != string(want) {
+				t.Errorf("%v after %v ticks doesn't match %v\ngot:\n%v\nwant:\n%v", name, ticks, goldenPath, got, string(want))
+			}
+		})
+	}
+}
+
+func TestIndexInRange(t *testing.T) {
+	w := MakeWorld(3, 4, 5)
+	tests := []struct {
+		x, y, z int
+		want    bool
+	}{
+		{0, 0, 0, true},
+		{2, 3, 4, true},
+		{-1, 0, 0, false},
+		{0, -1, 0, false},
+		{0, 0, -1, false},
+		{3, 0, 0, false},
+		{0, 4, 0, false},
+		{0, 0, 5, false},
+	}
+	for _, test := range tests {
+		if got := w.IndexInRange(test.x, test.y, test.z); got != test.want {
+			t.Errorf("IndexInRange(%v, %v, %v) = %v, want %v", test.x, test.y, test.z, got, test.want)
+		}
+	}
+}
+
+func TestSwapCellsMarksVisited(t *testing.T) {
+	w := MakeWorld(3, 3, 3)
+	w.Cells[1][2][1] = Cell{Type: DIRT}
+	w.SwapCells(1, 2, 1, 1, 1, 1)
+
+	if w.Cells[1][1][1].Type != DIRT || w.Cells[1][2][1].Type != AIR {
+		t.Errorf("cells weren't swapped")
+	}
+	if !w.Visited[1][2][1] || !w.Visited[1][1][1] {
+		t.Errorf("both swapped cells should be marked visited")
+	}
+	if w.Visited[0][0][0] {
+		t.Errorf("untouched cell was marked visited")
+	}
+}
+
+func TestSwapCellsIntoSink(t *testing.T) {
+	w := MakeWorld(1, 2, 1)
+	w.Cells[0][1][0] = Cell{Type: WATER}
+	w.Cells[0][0][0] = Cell{Type: SINK}
+	w.SwapCells(0, 1, 0, 0, 0, 0)
+
+	if w.Cells[0][1][0].Type != AIR || w.Cells[0][0][0].Type != SINK {
+		t.Errorf("water should have drained into the sink, got %v above %v",
+			CellTypeName(w.Cells[0][1][0].Type), CellTypeName(w.Cells[0][0][0].Type))
+	}
+}
+
+// TestDirtPileSlope checks a settled pile never drops more than one cell between neighbouring columns
+func TestDirtPileSlope(t *testing.T) {
+	w := MakeWorld(15, 12, 15)
+	w.SetSeed(1)
+	w.FillBox(7, 0, 7, 7, 11, 7, DIRT)
+	for i := 0; i < 100; i++ {
+		w.Update()
+	}
+
+	heights := make([][]int, w.Width)
+	for x := range heights {
+		heights[x] = make([]int, w.Depth)
+		for z := range heights[x] {
+			for y := 0; y < w.Height && w.Cells[x][y][z].Type == DIRT; y++ {
+				heights[x][z]++
+			}
+		}
+	}
+	for x := 0; x < w.Width; x++ {
+		for z := 0; z < w.Depth; z++ {
+			for _, d := range [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}} {
+				nx, nz := x+d[0], z+d[1]
+				if nx >= w.Width || nz < 0 || nz >= w.Depth {
+					continue
+				}
+				if diff := abs(heights[x][z] - heights[nx][nz]); diff > 1 {
+					t.Errorf("columns %v,%v and %v,%v differ by %v cells", x, z, nx, nz, diff)
+				}
+			}
+		}
+	}
+	if count := w.CountCells(DIRT); count != 12 {
+		t.Errorf("pile has %v dirt, want 12", count)
+	}
+}